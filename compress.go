@@ -0,0 +1,290 @@
+package web
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compressor compresses the response body for a content coding, such as gzip.
+// See CompressMiddleware.Register.
+type Compressor interface {
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+type GzipCompressor struct {
+	Level int // gzip.DefaultCompression if 0
+}
+
+func (g *GzipCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		gw = gzip.NewWriter(w)
+	}
+	return gw
+}
+
+// DeflateCompressor writes the "deflate" coding of HTTP, which is zlib-wrapped, see RFC 9110.
+type DeflateCompressor struct {
+	Level int // zlib.DefaultCompression if 0
+}
+
+func (d *DeflateCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	level := d.Level
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	zw, err := zlib.NewWriterLevel(w, level)
+	if err != nil {
+		zw = zlib.NewWriter(w)
+	}
+	return zw
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// CompressMiddleware compresses responses by the content coding negotiated with the
+// Accept-Encoding header. gzip and deflate are registered by default, others such as br
+// can be registered by a Compressor.
+//
+// Responses smaller than MinSize, with a content type which has been compressed such as
+// images, or partial ones of range requests, are not compressed. A strong ETag of a
+// compressed response is made weak, since the bytes differ from the identity one. Streamed results like SSE are compressed and flushed as
+// they go. To opt out for a route:
+//
+//	w.Append(web.NewCompressMiddleware())
+//	w.Handle("GET", "/download", Download).Remove("compress")
+type CompressMiddleware struct {
+	MinSize   int      // 1024 by default
+	SkipTypes []string // prefixes of content types not to compress
+
+	encodings   []string
+	compressors map[string]Compressor
+}
+
+func NewCompressMiddleware() *CompressMiddleware {
+	m := new(CompressMiddleware)
+	m.MinSize = 1024
+	m.SkipTypes = []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/pdf",
+	}
+	m.compressors = make(map[string]Compressor)
+
+	m.Register("gzip", new(GzipCompressor))
+	m.Register("deflate", new(DeflateCompressor))
+	return m
+}
+
+// Register a Compressor for a content coding. Codings registered earlier are preferred if
+// the client accepts them equally.
+func (m *CompressMiddleware) Register(encoding string, c Compressor) {
+	encoding = strings.ToLower(encoding)
+	if _, ok := m.compressors[encoding]; !ok {
+		m.encodings = append(m.encodings, encoding)
+	}
+	m.compressors[encoding] = c
+}
+
+func (m *CompressMiddleware) Name() string {
+	return "compress"
+}
+
+func (m *CompressMiddleware) ServeMiddleware(c *Context) error {
+	c.ResponseHeader.Add("Vary", "Accept-Encoding")
+
+	encoding := m.negotiate(c.Request.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return nil
+	}
+
+	cw := &compressWriter{ResponseWriter: c.ResponseWriter, m: m, encoding: encoding, code: StatusOK}
+	c.ResponseWriter = cw
+	c.Defer(func() { cw.Close() })
+	return nil
+}
+
+// choose the coding with highest q-value
+func (m *CompressMiddleware) negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		qs[coding] = q
+	}
+
+	var best string
+	var bestQ float64
+	for _, encoding := range m.encodings {
+		q, ok := qs[encoding]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func (m *CompressMiddleware) compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, t := range m.SkipTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+var _ Middleware = (*CompressMiddleware)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// compressWriter buffers the beginning of the body to decide whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+
+	m        *CompressMiddleware
+	encoding string
+
+	code    int
+	decided bool
+	buf     []byte
+	writer  io.WriteCloser // nil if not compressed
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.m.MinSize && !w.lengthKnown() {
+			return len(p), nil
+		}
+		if err := w.decide(len(w.buf) >= w.m.MinSize); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush the compressed data to the client, for streamed results.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	w.decided = true
+	return h.Hijack()
+}
+
+// Close the compressor after the response is written.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(len(w.buf) >= w.m.MinSize); err != nil {
+			return err
+		}
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
+
+// Content-Length is set and known to be small
+func (w *compressWriter) lengthKnown() bool {
+	n, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	return err == nil && n < w.m.MinSize && len(w.buf) >= n
+}
+
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf)) // not to sniff the compressed data
+	}
+
+	if compress && w.m.compressible(header) && header.Get("Content-Range") == "" {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges") // ranges are of the identity body
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.writer = w.m.compressors[w.encoding].NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+var _ http.Flusher = (*compressWriter)(nil)
+var _ http.Hijacker = (*compressWriter)(nil)
@@ -0,0 +1,204 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	w := NewWeb()
+	w.Append(NewCompressMiddleware())
+
+	var list []Result
+	for i := 0; i < 100; i++ {
+		list = append(list, Result{"id": i, "name": "item"})
+	}
+	w.Handle("GET", "/list", func(c *Context) interface{} {
+		return list
+	})
+	w.Handle("GET", "/small", func(c *Context) interface{} {
+		return Result{"ok": true}
+	})
+	w.Handle("GET", "/image", func(c *Context) interface{} {
+		return Raw("image/png", bytes.Repeat([]byte{1}, 4096))
+	})
+	w.Handle("GET", "/raw", func(c *Context) interface{} {
+		return list
+	}).Remove("compress")
+	w.Handle("POST", "/echo", func(c *Context) interface{} {
+		return c.Values
+	})
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// gzip
+	rec := get("/list", "deflate;q=0.5, gzip")
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", ce)
+	}
+	if v := rec.Header().Get("Vary"); v != "Accept-Encoding" {
+		t.Errorf("Vary = %q", v)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gr)
+	if err != nil || !bytes.HasPrefix(data, []byte(`[{"id":0`)) {
+		t.Errorf("decompressed = %.20s, err = %v", data, err)
+	}
+
+	// not compressed
+	for _, c := range []struct{ path, encoding string }{
+		{"/list", ""},
+		{"/list", "br"},
+		{"/list", "gzip;q=0"},
+		{"/small", "gzip"},
+		{"/image", "gzip"},
+		{"/raw", "gzip"},
+	} {
+		rec = get(c.path, c.encoding)
+		if ce := rec.Header().Get("Content-Encoding"); ce != "" || rec.Code != StatusOK {
+			t.Errorf("%s %q: code = %d, Content-Encoding = %q", c.path, c.encoding, rec.Code, ce)
+		}
+	}
+
+	// gzip request body
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(`{"name":"gopher"}`))
+	gw.Close()
+
+	r := httptest.NewRequest("POST", "/echo", &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if body := rec.Body.String(); rec.Code != StatusOK || !strings.Contains(body, `"gopher"`) {
+		t.Errorf("code = %d, body = %s", rec.Code, body)
+	}
+
+	r = httptest.NewRequest("POST", "/echo", strings.NewReader("{}"))
+	r.Header.Set("Content-Encoding", "zstd")
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if rec.Code != StatusUnsupportedMediaType {
+		t.Errorf("code = %d; want %d", rec.Code, StatusUnsupportedMediaType)
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	w := NewWeb()
+	w.Append(NewCompressMiddleware())
+	w.Handle("GET", "/stream", func(c *Context) interface{} {
+		i := 0
+		return Stream(func() (interface{}, bool, error) {
+			i++
+			return i, i <= 3, nil
+		})
+	})
+
+	svr := httptest.NewServer(w)
+	defer svr.Close()
+
+	r, _ := http.NewRequest("GET", svr.URL+"/stream", nil)
+	r.Header.Set("Accept-Encoding", "gzip") // disable transparent decompression
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", ce)
+	}
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(gr)
+	if string(data) != "[1\n,2\n,3\n]" {
+		t.Errorf("body = %q", data)
+	}
+}
+
+func TestCompressDeflateAndRange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.txt")
+	if err := ioutil.WriteFile(path, bytes.Repeat([]byte("0123456789"), 1200), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(NewCompressMiddleware())
+	w.Handle("GET", "/file", func(c *Context) interface{} {
+		return File(path)
+	})
+	w.Handle("GET", "/versioned", func(c *Context) interface{} {
+		c.ResponseHeader.Set("ETag", `"v1"`)
+		return strings.Repeat("a", 2048)
+	})
+	w.Handle("POST", "/echo", func(c *Context) interface{} {
+		return c.Values
+	})
+
+	// deflate is zlib-wrapped, and the ETag is weakened
+	r := httptest.NewRequest("GET", "/versioned", nil)
+	r.Header.Set("Accept-Encoding", "deflate")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if ce, etag := rec.Header().Get("Content-Encoding"), rec.Header().Get("ETag"); ce != "deflate" || etag != `W/"v1"` {
+		t.Errorf("Content-Encoding = %q, ETag = %q", ce, etag)
+	}
+	zr, err := zlib.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(zr); err != nil || len(data) != 2048 {
+		t.Errorf("decompressed %d bytes, err = %v", len(data), err)
+	}
+
+	// partial responses are not compressed
+	r = httptest.NewRequest("GET", "/file", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=0-1999")
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 2000 {
+		t.Errorf("code = %d, Content-Encoding = %q, body = %d bytes", rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.Len())
+	}
+
+	// deflate request body
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(`{"name":"gopher"}`))
+	zw.Close()
+
+	r = httptest.NewRequest("POST", "/echo", &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "deflate")
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if body := rec.Body.String(); rec.Code != StatusOK || !strings.Contains(body, `"gopher"`) {
+		t.Errorf("code = %d, body = %s", rec.Code, body)
+	}
+}
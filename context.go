@@ -1,22 +1,45 @@
 package web
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/textproto"
-	"sync/atomic"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 var MaxBodyLength int64 = 20 * (1 << 20) // 20M
 
+// The precedence of locations when merging params into Context.Values, the former wins.
+// A location not in the list will not be merged, but still available by Context.Param
+// and by the location option of Scheme tags.
+//
+// Path wins by default, so that a query or body can't override the resource addressed by
+// the url, such as the id of "/users/{id}". Body still wins over query as before. It's the
+// default of Webs which don't set one by Web.SetParamsPrecedence.
+var ParamsPrecedence = []string{LocationPath, LocationBody, LocationQuery}
+
 type Context struct {
 	Request   *http.Request
-	RequestId int64
+	RequestId string // from the RequestIdHeader of the request, or generated by NewRequestId
+	Route     string // path template of the matched route, such as "/users/{id}"
 
 	ResponseWriter http.ResponseWriter
 	ResponseHeader http.Header
 
-	Values map[string]interface{}
+	// Values merges params from url path, url query and body. If a key appears in more than
+	// one location, the one comes first in the precedence wins, see ParamsPrecedence. Sources records which
+	// location each key of Values comes from, see LocationPath etc.
+	Values  map[string]interface{}
+	Sources map[string]string
 
 	RawPostData []byte
 
@@ -26,14 +49,42 @@ type Context struct {
 		Header   textproto.MIMEHeader
 		Data     []byte
 	}
+
+	params map[string]map[string]interface{} // location -> key -> value
+	forms  map[string]url.Values             // location -> key -> all values, for repeated params
+
+	decoders   map[string]Decoder
+	responser  Responser // of the handler, for Writeable results to write errors
+	precedence []string  // of the Web, ParamsPrecedence if nil
+	defers     []func()
+	secrets    map[string]bool // lower case keys of params redacted in logs
+	onPanic    func(c *Context, v interface{}, stack []byte)
+	panics     int
+	span       *Span
+	timeout    *Error // responsed if the handler overruns, set by TimeoutMiddleware
+
+	responsedErr error     // the error result responsed, set before defers run
+	start        time.Time // when the request is received, before the body is read
+	bodySize     int64     // bytes of body received, before decompressed
+
+	store     map[string]interface{} // by Set, never written by params
+	storeLock sync.Mutex
+
+	// guards secrets, defers and slogLogger, which a handler still running after the
+	// TimeoutMiddleware expires may touch while the response is written and logged
+	lock sync.Mutex
+
+	writer     *responseWriter
+	slog       *slog.Logger // base of Logger
+	slogLogger *slog.Logger
 }
 
 func (c *Context) Scheme(ptrArgs interface{}) error {
-	return Scheme(c.Values, ptrArgs)
+	return scheme(c.Values, c, ptrArgs)
 }
 
 func (c *Context) SchemeParam(ptrArg interface{}, tag string) error {
-	return SchemeParam(c.Values, ptrArg, tag)
+	return schemeParam(c.Values, c, ptrArg, tag)
 }
 
 func (c *Context) SchemeInt(tag string) (v int, err error) {
@@ -56,22 +107,207 @@ func (c *Context) SchemeBool(tag string) (v bool, err error) {
 	return
 }
 
+// Register a function to be called after the response is written, such as to close a
+// writer which wraps ResponseWriter. Functions are called in reverse order.
+func (c *Context) Defer(fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.defers = append(c.defers, fn)
+}
+
+func (c *Context) runDefers() {
+	c.lock.Lock()
+	defers := c.defers
+	c.defers = nil
+	c.lock.Unlock()
+
+	for i := len(defers) - 1; i >= 0; i-- {
+		defers[i]()
+	}
+}
+
+// Set a value for the request, such as by a middleware for handlers. Unlike Values, it's
+// never written by request params. It's also got by Value as a context.Context.
+func (c *Context) Set(key string, value interface{}) {
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+	if c.store == nil {
+		c.store = make(map[string]interface{})
+	}
+	c.store[key] = value
+}
+
+// Get a value set by Set. See Value for a typed one.
+func (c *Context) Get(key string) (v interface{}, ok bool) {
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+	v, ok = c.store[key]
+	return
+}
+
+// Get a value set by Context.Set as type T. False if not found or not a T.
+//
+//	user, ok := web.Value[*User](c, "user")
+func Value[T any](c *Context, key string) (v T, ok bool) {
+	x, found := c.Get(key)
+	if !found {
+		return v, false
+	}
+	v, ok = x.(T)
+	return v, ok
+}
+
+// Context implements context.Context by the context of Request, which is canceled when the
+// client disconnects or the TimeoutMiddleware of the route expires. Pass it to calls which
+// should stop with the request, such as database queries:
+//
+//	rows, err := db.QueryContext(c, query, args...)
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.Request.Context().Deadline()
+}
+
+// Closed when the request is canceled. Long handlers should stop early:
+//
+//	select {
+//	case <-c.Done():
+//		return c.Err()
+//	case item := <-items:
+//		...
+//	}
+func (c *Context) Done() <-chan struct{} {
+	return c.Request.Context().Done()
+}
+
+// context.Canceled if the client disconnected, or context.DeadlineExceeded if timed out.
+func (c *Context) Err() error {
+	return c.Request.Context().Err()
+}
+
+// Get a value set by Set for a string key, or from the context of Request otherwise.
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, ok := c.Get(k); ok {
+			return v
+		}
+	}
+	return c.Request.Context().Value(key)
+}
+
+// Whether the request is canceled, a shortcut of c.Err() != nil for loops.
+func (c *Context) Canceled() bool {
+	return c.Err() != nil
+}
+
+// Get a param from a specified location, without regard to the precedence.
+// Location can be LocationPath, LocationQuery or LocationBody.
+func (c *Context) Param(location string, key string) (v interface{}, ok bool) {
+	v, ok = c.params[location][key]
+	return
+}
+
+// Get all values of a repeated param from a specified location.
+// Location can be LocationPath, LocationQuery or LocationBody.
+func (c *Context) ParamValues(location string, key string) []string {
+	return c.forms[location][key]
+}
+
+func (c *Context) setValue(k string, v interface{}, location string) {
+	m, ok := c.params[location]
+	if !ok {
+		m = make(map[string]interface{})
+		c.params[location] = m
+	}
+	m[k] = v
+}
+
+// set the first value as the param and keep all of them
+func (c *Context) setValues(k string, vs []string, location string) {
+	c.setValue(k, vs[0], location)
+	c.form(location)[k] = vs
+}
+
+// append a value of a repeated param, the first one is the param as setValues
+func (c *Context) addValue(k string, v string, location string) {
+	if _, ok := c.params[location][k]; !ok {
+		c.setValue(k, v, location)
+	}
+	c.form(location).Add(k, v)
+}
+
+func (c *Context) setSecret(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.secrets == nil {
+		c.secrets = make(map[string]bool)
+	}
+	c.secrets[strings.ToLower(key)] = true
+}
+
+// get a copy of secrets for loggers
+func (c *Context) secretKeys() map[string]bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	secrets := make(map[string]bool, len(c.secrets))
+	for k := range c.secrets {
+		secrets[k] = true
+	}
+	return secrets
+}
+
+func (c *Context) form(location string) url.Values {
+	f, ok := c.forms[location]
+	if !ok {
+		f = make(url.Values)
+		c.forms[location] = f
+	}
+	return f
+}
+
+func (c *Context) paramsPrecedence() []string {
+	if c.precedence != nil {
+		return c.precedence
+	}
+	return ParamsPrecedence
+}
+
+// merge params into Values by the order of the precedence
+func (c *Context) mergeValues() {
+	precedence := c.paramsPrecedence()
+	for i := len(precedence) - 1; i >= 0; i-- {
+		location := precedence[i]
+		for k, v := range c.params[location] {
+			c.Values[k] = v
+			c.Sources[k] = location
+		}
+	}
+}
+
+var _ context.Context = (*Context)(nil)
+
 ///////////////////////////////////////////////////////////////////////////////
 
 func newContext(w http.ResponseWriter, r *http.Request) (*Context, error) {
 	var err error
 
 	c := new(Context)
+	c.start = time.Now()
 
 	c.Request = r
-	c.RequestId = atomic.AddInt64(&globalReqId, 1)
 
 	if w != nil {
+		c.writer = newResponseWriter(w, c.start)
 		c.ResponseHeader = w.Header()
+		c.ResponseWriter = c.writer
 	}
-	c.ResponseWriter = w
+
+	c.RequestId = requestId(c)
+	c.Request = r.WithContext(context.WithValue(r.Context(), requestIdKey{}, c.RequestId))
+	r = c.Request
 
 	c.Values = make(map[string]interface{})
+	c.Sources = make(map[string]string)
+	c.params = make(map[string]map[string]interface{}, 3)
+	c.forms = make(map[string]url.Values, 3)
 
 	if r.Body != nil {
 		mr := http.MaxBytesReader(w, r.Body, MaxBodyLength)
@@ -82,9 +318,49 @@ func newContext(w http.ResponseWriter, r *http.Request) (*Context, error) {
 		if err != nil {
 			return c, NewError(err.Error(), StatusBadRequest)
 		}
+		c.bodySize = int64(len(c.RawPostData))
+
+		c.RawPostData, err = decompressBody(r, c.RawPostData)
+		if err != nil {
+			return c, err
+		}
 	}
 
 	return c, nil
 }
 
-var globalReqId int64
+// decompress the body by Content-Encoding, limited by MaxBodyLength after decompressed
+func decompressBody(r *http.Request, data []byte) ([]byte, error) {
+	var err error
+	var reader io.ReadCloser
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, NewErrorMsg("invalid body", err.Error(), StatusBadRequest)
+		}
+	case "deflate": // zlib-wrapped, see RFC 9110
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, NewErrorMsg("invalid body", err.Error(), StatusBadRequest)
+		}
+	default:
+		return nil, NewErrorMsg("unsupported content encoding", encoding, StatusUnsupportedMediaType).WithReason(ReasonUnsupportedMediaType)
+	}
+	defer reader.Close()
+
+	data, err = ioutil.ReadAll(io.LimitReader(reader, MaxBodyLength+1))
+	if err != nil {
+		return nil, NewErrorMsg("invalid body", err.Error(), StatusBadRequest)
+	}
+	if int64(len(data)) > MaxBodyLength {
+		return nil, NewError("http: request body too large", http.StatusRequestEntityTooLarge)
+	}
+
+	r.Header.Del("Content-Encoding")
+	return data, nil
+}
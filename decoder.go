@@ -0,0 +1,146 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Decoder decodes the request body into params. It is chosen by the media type of
+// Content-Type header. See Web.RegisterDecoder.
+//
+// Only the top layer of the body is decoded. A value can be a string, a number, a bool,
+// or a []string for repeated params. Nested objects or arrays should be kept as JSON
+// strings, so that Scheme can unpack them into struct or slice fields.
+type Decoder interface {
+	Decode(body []byte, params map[string]string) (map[string]interface{}, error)
+}
+
+// Media types of the built-in decoders.
+const (
+	MediaTypeJSON    = "application/json"
+	MediaTypeXML     = "application/xml"
+	MediaTypeTextXML = "text/xml"
+	MediaTypeMsgpack = "application/msgpack"
+)
+
+// Decoders used if none is registered by Web. Don't modify it, call Web.RegisterDecoder instead.
+var defaultDecoders = map[string]Decoder{
+	MediaTypeJSON:             new(JSONDecoder),
+	MediaTypeXML:              new(XMLDecoder),
+	MediaTypeTextXML:          new(XMLDecoder),
+	MediaTypeMsgpack:          new(MsgpackDecoder),
+	"application/x-msgpack":   new(MsgpackDecoder),
+	"application/vnd.msgpack": new(MsgpackDecoder),
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// JSONDecoder decodes the top layer of a JSON object.
+type JSONDecoder struct {
+}
+
+func (d *JSONDecoder) Decode(body []byte, params map[string]string) (map[string]interface{}, error) {
+	var jsonValues = make(map[string]json.RawMessage) // just unpack the top layer of json struct
+
+	err := json.Unmarshal(body, &jsonValues)
+	if err != nil {
+		return nil, NewError(fmt.Sprintf("not json parameter: %s", err), StatusBadRequest)
+	}
+
+	vals := make(map[string]interface{}, len(jsonValues))
+	for k, raw := range jsonValues {
+		if len(raw) > 0 && (raw[0] != '"') {
+			vals[k] = string(raw) // not unpack json slice or object
+			continue
+		}
+		var v interface{}
+		err = json.Unmarshal(raw, &v)
+		if err != nil {
+			e := NewError(fmt.Sprintf("not json parameter: %s", err), StatusBadRequest)
+			return nil, e.AddDetail(k, LocationBody, FieldInvalid, err.Error())
+		}
+		vals[k] = v
+	}
+	return vals, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// XMLDecoder decodes the child elements of the root element. For example:
+//
+//	<message><id>1</id><tag>a</tag><tag>b</tag></message>
+//
+// is decoded as {"id": "1", "tag": []string{"a", "b"}}. The inner XML is kept for
+// an element which has children.
+type XMLDecoder struct {
+}
+
+func (d *XMLDecoder) Decode(body []byte, params map[string]string) (map[string]interface{}, error) {
+	var root struct {
+		Children []struct {
+			XMLName xml.Name
+			Text    string `xml:",chardata"` // with CDATA decoded
+			Inner   string `xml:",innerxml"`
+			Elems   []struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:",any"`
+	}
+
+	err := xml.NewDecoder(bytes.NewReader(body)).Decode(&root)
+	if err != nil {
+		return nil, NewError(fmt.Sprintf("not xml parameter: %s", err), StatusBadRequest)
+	}
+
+	vals := make(map[string]interface{}, len(root.Children))
+	for _, child := range root.Children {
+		k, v := child.XMLName.Local, child.Text
+		if len(child.Elems) > 0 {
+			v = child.Inner
+		}
+
+		switch old := vals[k].(type) {
+		case nil:
+			vals[k] = v
+		case string:
+			vals[k] = []string{old, v}
+		case []string:
+			vals[k] = append(old, v)
+		}
+	}
+	return vals, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// MsgpackDecoder decodes the top layer of a MessagePack map.
+type MsgpackDecoder struct {
+}
+
+func (d *MsgpackDecoder) Decode(body []byte, params map[string]string) (map[string]interface{}, error) {
+	var values map[string]interface{}
+
+	err := msgpack.Unmarshal(body, &values)
+	if err != nil {
+		return nil, NewError(fmt.Sprintf("not msgpack parameter: %s", err), StatusBadRequest)
+	}
+
+	for k, v := range values {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			data, err := json.Marshal(v) // not unpack slice or object, the same as json
+			if err != nil {
+				e := NewError(fmt.Sprintf("not msgpack parameter: %s", err), StatusBadRequest)
+				return nil, e.AddDetail(k, LocationBody, FieldInvalid, err.Error())
+			}
+			values[k] = string(data)
+		case []byte:
+			values[k] = string(v.([]byte))
+		}
+	}
+	return values, nil
+}
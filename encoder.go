@@ -0,0 +1,289 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Encoder encodes a result into response body. See NegotiatingResponser.
+//
+// An Encoder may also implement
+//
+//	CanEncode(result interface{}) bool
+//
+// to be skipped for results it can't encode, such as CSVEncoder for a non-slice result.
+type Encoder interface {
+	ContentType() string
+	Encode(w io.Writer, result interface{}) error
+}
+
+// Media types of the built-in encoders.
+const (
+	MediaTypeCSV  = "text/csv"
+	MediaTypeYAML = "application/yaml"
+)
+
+type encoderChecker interface {
+	CanEncode(result interface{}) bool
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// JSONEncoder encodes the result in JSON format, the same as DefaultResponser.
+type JSONEncoder struct {
+}
+
+func (e *JSONEncoder) ContentType() string {
+	return "application/json;charset=utf-8"
+}
+
+func (e *JSONEncoder) Encode(w io.Writer, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// XMLEncoder encodes the result in XML format, under a root element <result>.
+// Names of elements are the same as JSON. Items of a slice are encoded as <item>.
+type XMLEncoder struct {
+}
+
+func (e *XMLEncoder) ContentType() string {
+	return "application/xml;charset=utf-8"
+}
+
+func (e *XMLEncoder) Encode(w io.Writer, result interface{}) error {
+	v, err := genericValue(result)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	if err = encodeXMLElement(enc, "result", v); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			if err := encodeXMLElement(enc, k, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// MsgpackEncoder encodes the result in MessagePack format. Struct fields are named
+// by the json tag.
+type MsgpackEncoder struct {
+}
+
+func (e *MsgpackEncoder) ContentType() string {
+	return MediaTypeMsgpack
+}
+
+func (e *MsgpackEncoder) Encode(w io.Writer, result interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(result)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// CSVEncoder encodes a slice result in CSV format, one row for each item. The header
+// row is the names of fields or keys. Nested objects and arrays are encoded as JSON.
+type CSVEncoder struct {
+}
+
+func (e *CSVEncoder) ContentType() string {
+	return "text/csv;charset=utf-8"
+}
+
+func (e *CSVEncoder) CanEncode(result interface{}) bool {
+	t := reflect.TypeOf(result)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+func (e *CSVEncoder) Encode(w io.Writer, result interface{}) error {
+	if !e.CanEncode(result) {
+		return fmt.Errorf("csv: can't encode %T", result)
+	}
+
+	v, err := genericValue(result)
+	if err != nil {
+		return err
+	}
+	items, _ := v.([]interface{})
+
+	// header
+	var header []string
+	var seen = make(map[string]bool)
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, k := range sortedKeys(m) {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+	}
+	if header == nil {
+		header = []string{"value"}
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(header))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{"value": item}
+		}
+		for i, k := range header {
+			row[i] = csvCell(m[k])
+		}
+		if err = cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// YAMLEncoder encodes the result in YAML format. Keys are the same as JSON.
+type YAMLEncoder struct {
+}
+
+func (e *YAMLEncoder) ContentType() string {
+	return "application/yaml;charset=utf-8"
+}
+
+func (e *YAMLEncoder) Encode(w io.Writer, result interface{}) error {
+	v, err := genericValue(result)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	if err = enc.Encode(yamlValue(v)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// json.Number is encoded as string by yaml, convert it to number
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = yamlValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlValue(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Convert the result to maps, slices and scalars by JSON. So that all encoders name the
+// fields in the same way.
+func genericValue(result interface{}) (interface{}, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
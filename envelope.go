@@ -0,0 +1,104 @@
+package web
+
+import (
+	"net/http"
+)
+
+// EnvelopeResponser wraps every result into an Envelope, so that all responses have the same shape:
+//
+//	{"code":200,"data":{"id":1},"error":null,"request_id":"0192b3c4-5d6e-7f80-9a1b-2c3d4e5f6a7b"}
+//	{"code":404,"data":null,"error":{"error":"not found"},"request_id":"0192b3c4-5d6f-7a01-8b2c-3d4e5f6a7b8c"}
+//
+// An error is placed in the error field, and the status code of result goes into the code field.
+// Raw []byte, Writeable and bodiless results (204, 304) are not wrapped. The envelope is written by the inner
+// Responser, DefaultResponser if nil. To use it:
+//
+//	w.SetResponser(web.NewEnvelopeResponser(nil))
+type EnvelopeResponser struct {
+	// Always response HTTP status 200 if true. The status code is only in the envelope then.
+	ForceOK bool
+
+	inner Responser
+}
+
+type Envelope struct {
+	Code      int         `json:"code"`
+	Data      interface{} `json:"data"`
+	Error     *Error      `json:"error"`
+	RequestId string      `json:"request_id"`
+
+	forceOK bool
+	headers http.Header
+}
+
+func (e *Envelope) Headers() http.Header {
+	return e.headers
+}
+
+func (e *Envelope) StatusCode() int {
+	if e.forceOK {
+		return StatusOK
+	}
+	return e.Code
+}
+
+func NewEnvelopeResponser(inner Responser) *EnvelopeResponser {
+	if inner == nil {
+		inner = new(DefaultResponser)
+	}
+	r := new(EnvelopeResponser)
+	r.inner = inner
+	return r
+}
+
+func (r *EnvelopeResponser) Response(w http.ResponseWriter, result interface{}) (int, error) {
+	return r.response(nil, w, result)
+}
+
+func (r *EnvelopeResponser) ResponseContext(c *Context, result interface{}) (int, error) {
+	return r.response(c, c.ResponseWriter, result)
+}
+
+func (r *EnvelopeResponser) response(c *Context, w http.ResponseWriter, result interface{}) (int, error) {
+	switch v := result.(type) {
+	case []byte:
+		return response(r.inner, c, w, v)
+
+	case Writeable:
+		return response(r.inner, c, w, v)
+
+	case *Payload:
+		if v.Code == http.StatusNoContent || v.Code == http.StatusNotModified {
+			return response(r.inner, c, w, v) // no body allowed
+		}
+	}
+
+	return response(r.inner, c, w, r.Wrap(c, result))
+}
+
+// Wrap a result into an Envelope. The context can be nil.
+func (r *EnvelopeResponser) Wrap(c *Context, result interface{}) *Envelope {
+	env := new(Envelope)
+	env.forceOK = r.ForceOK
+
+	if c != nil {
+		env.RequestId = c.RequestId
+	}
+
+	if hs, ok := result.(Headers); ok {
+		env.headers = hs.Headers()
+	}
+
+	result, env.Code = statusResult(result)
+	if e, ok := result.(*Error); ok {
+		env.Error = e
+	} else {
+		env.Data = result
+	}
+	return env
+}
+
+var _ Responser = (*EnvelopeResponser)(nil)
+var _ ContextResponser = (*EnvelopeResponser)(nil)
+var _ StatusCode = (*Envelope)(nil)
+var _ Headers = (*Envelope)(nil)
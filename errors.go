@@ -0,0 +1,101 @@
+package web
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Debug mode responses internal details of errors, such as the wrapped error of a server
+// error. Never enable it in production.
+var Debug = false
+
+// Reasons of errors responsed by this package.
+const (
+	ReasonInternal             = "internal"
+	ReasonInvalidArgument      = "invalid_argument"
+	ReasonUnsupportedMediaType = "unsupported_media_type"
+	ReasonNotAcceptable        = "not_acceptable"
+	ReasonPreconditionFailed   = "precondition_failed"
+	ReasonTimeout              = "timeout"
+)
+
+type errorMapping struct {
+	is  error        // matched by errors.Is if not nil
+	as  reflect.Type // matched by errors.As otherwise
+	err *Error
+}
+
+var (
+	errorMappings     []errorMapping
+	errorMappingsLock sync.RWMutex
+)
+
+// Register a sentinel error, which is responsed as e if a returned error is it or wraps it.
+//
+//	web.RegisterError(sql.ErrNoRows, web.NewError("not found", web.StatusNotFound).WithReason("not_found"))
+func RegisterError(target error, e *Error) {
+	if target == nil || e == nil {
+		panic("web: register nil error")
+	}
+	errorMappingsLock.Lock()
+	defer errorMappingsLock.Unlock()
+	errorMappings = append(errorMappings, errorMapping{is: target, err: e})
+}
+
+// Register an error type, which is responsed as e if a returned error is of the type or wraps
+// one. The target is a value of the type, such as (*QuotaError)(nil).
+func RegisterErrorType(target error, e *Error) {
+	if target == nil || e == nil {
+		panic("web: register nil error")
+	}
+	errorMappingsLock.Lock()
+	defer errorMappingsLock.Unlock()
+	errorMappings = append(errorMappings, errorMapping{as: reflect.TypeOf(target), err: e})
+}
+
+// Convert an error to *Error which is responsed. It returns the *Error if err is or wraps one,
+// or the registered *Error if err matches one, which wraps err. Otherwise err is regarded as
+// an internal error with a 500 status code, and its message is not responsed.
+func ToError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	errorMappingsLock.RLock()
+	defer errorMappingsLock.RUnlock()
+
+	for _, m := range errorMappings {
+		if m.matches(err) {
+			e := *m.err
+			e.err = err
+			return &e
+		}
+	}
+
+	return NewError("server error", StatusInternalServerError).WithReason(ReasonInternal).Wrap(err)
+}
+
+func (m *errorMapping) matches(err error) bool {
+	if m.is != nil {
+		return errors.Is(err, m.is)
+	}
+	target := reflect.New(m.as)
+	return errors.As(err, target.Interface())
+}
+
+// The *Error to response, with the wrapped error in Cause in debug mode.
+func publicError(err error) *Error {
+	e := ToError(err)
+	if !Debug || e.err == nil || e.Cause != "" {
+		return e
+	}
+	d := *e
+	d.Cause = e.err.Error()
+	return &d
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+var errTestNoRows = errors.New("no rows")
+
+type testQuotaError struct {
+	Limit int
+}
+
+func (e *testQuotaError) Error() string {
+	return fmt.Sprintf("quota %d exceeded", e.Limit)
+}
+
+func TestToError(t *testing.T) {
+	RegisterError(errTestNoRows, NewError("not found", StatusNotFound).WithReason("not_found"))
+	RegisterErrorType((*testQuotaError)(nil), NewError("too many requests", 429).WithReason("quota"))
+
+	notFound := NewError("not found", StatusNotFound).WithReason("not_found")
+
+	testCases := []struct {
+		Err    error
+		Code   int
+		Reason string
+		Body   string
+	}{
+		{fmt.Errorf("get user: %w", errTestNoRows), StatusNotFound, "not_found", `{"error":"not found","reason":"not_found"}`},
+		{fmt.Errorf("limit: %w", &testQuotaError{10}), 429, "quota", `{"error":"too many requests","reason":"quota"}`},
+		{fmt.Errorf("wrapped: %w", NewErrorMsg("invalid argument", "bad id", StatusBadRequest)), StatusBadRequest, "", `{"error":"invalid argument","message":"bad id"}`},
+		{errors.New("pq: connection refused"), StatusInternalServerError, ReasonInternal, `{"error":"server error","reason":"internal"}`},
+		{WrapError(errors.New("pq: connection refused"), "query failed", 503), 503, "", `{"error":"query failed"}`},
+	}
+
+	for i, tt := range testCases {
+		e := ToError(tt.Err)
+		if e.Code != tt.Code || e.Reason != tt.Reason {
+			t.Errorf("case %v: code = %v, reason = %q; want %v %q", i, e.Code, e.Reason, tt.Code, tt.Reason)
+		}
+
+		w := httptest.NewRecorder()
+		new(DefaultResponser).Response(w, tt.Err)
+		if w.Code != tt.Code || w.Body.String() != tt.Body {
+			t.Errorf("case %v: response = %v %s; want %v %s", i, w.Code, w.Body, tt.Code, tt.Body)
+		}
+	}
+
+	// errors.Is and errors.As through *Error
+	e := ToError(fmt.Errorf("get user: %w", errTestNoRows))
+	if !errors.Is(e, errTestNoRows) || !errors.Is(e, notFound) {
+		t.Errorf("errors.Is failed for %v", e)
+	}
+	var qe *testQuotaError
+	if !errors.As(ToError(&testQuotaError{3}), &qe) || qe.Limit != 3 {
+		t.Errorf("errors.As failed")
+	}
+
+	// details in debug mode
+	Debug = true
+	defer func() { Debug = false }()
+
+	w := httptest.NewRecorder()
+	new(DefaultResponser).Response(w, errors.New("pq: connection refused"))
+	want := `{"error":"server error","reason":"internal","cause":"pq: connection refused"}`
+	if w.Body.String() != want {
+		t.Errorf("debug body = %s; want %s", w.Body, want)
+	}
+}
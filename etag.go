@@ -0,0 +1,325 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagger is implemented by a result which knows its entity tag, such as a version or a
+// hash of a record. The tag is quoted as a strong one if it's not quoted, prefix it with
+// W/ for a weak one.
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier is implemented by a result which knows its modification time.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// ETagMiddleware answers conditional requests, see RFC 7232.
+//
+// For GET and HEAD, the ETag is got from the result if it implements ETagger, otherwise it's
+// computed over the rendered body. A 304 Not Modified is responded if If-None-Match or
+// If-Modified-Since matches. Streamed results and bodies larger than MaxSize are not tagged.
+//
+// For PUT, PATCH and DELETE, If-Match and If-Unmodified-Since are checked against the current
+// version of the resource got by Version, before the handler is called. A 412 Precondition
+// Failed is responded if they don't match. Handlers can also check by Context.CheckConditions.
+//
+//	m := web.NewETagMiddleware()
+//	m.Version = func(c *web.Context) (string, time.Time, error) {
+//		doc, err := db.GetDoc(c.Values["id"])
+//		if err != nil {
+//			return "", time.Time{}, nil // not found, If-Match: * fails
+//		}
+//		return doc.Version, doc.Updated, nil
+//	}
+//	w.Append(m)
+type ETagMiddleware struct {
+	Weak    bool // compute weak ETags, if the body is not byte-for-byte stable
+	MaxSize int  // max size of body to compute ETags, 1M by default
+
+	// Get the current version of the resource for PUT, PATCH and DELETE. Empty etag and zero
+	// time if the resource doesn't exist. Preconditions are not checked here if it's nil.
+	Version func(c *Context) (etag string, lastModified time.Time, err error)
+}
+
+func NewETagMiddleware() *ETagMiddleware {
+	m := new(ETagMiddleware)
+	m.MaxSize = 1 << 20
+	return m
+}
+
+func (m *ETagMiddleware) Name() string {
+	return "etag"
+}
+
+func (m *ETagMiddleware) ServeMiddleware(c *Context) error {
+	switch c.Request.Method {
+	case "GET", "HEAD":
+		ew := &etagWriter{ResponseWriter: c.ResponseWriter, m: m, r: c.Request, code: StatusOK, buffering: true}
+		c.ResponseWriter = ew
+		c.Defer(func() { ew.Close() })
+
+	case "PUT", "PATCH", "DELETE":
+		h := c.Request.Header
+		if m.Version == nil || (h.Get("If-Match") == "" && h.Get("If-Unmodified-Since") == "") {
+			return nil
+		}
+		etag, modified, err := m.Version(c)
+		if err != nil {
+			return err
+		}
+		if checkConditions(c.Request, quoteETag(etag), modified) == StatusPreconditionFailed {
+			return NewError("precondition failed", StatusPreconditionFailed).WithReason(ReasonPreconditionFailed)
+		}
+	}
+	return nil
+}
+
+func (m *ETagMiddleware) ServeResponse(c *Context, result interface{}) (interface{}, error) {
+	etag, modified := resultVersion(result)
+	if etag == "" && modified.IsZero() {
+		return result, nil
+	}
+
+	if etag != "" {
+		c.ResponseHeader.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		c.ResponseHeader.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	method := c.Request.Method
+	if method != "GET" && method != "HEAD" {
+		return result, nil // the new version after modified
+	}
+	if code := checkConditions(c.Request, etag, modified); code != 0 {
+		return conditionResult(code), nil
+	}
+	return result, nil
+}
+
+var _ Middleware = (*ETagMiddleware)(nil)
+var _ ResponseMiddleware = (*ETagMiddleware)(nil)
+
+// Check conditional headers of the request against the current version of the resource.
+// It returns nil if the request should go on, otherwise a result of 304 Not Modified or
+// 412 Precondition Failed which should be returned by the handler. Use an empty etag and
+// zero time if the resource doesn't exist.
+//
+//	if r := c.CheckConditions(doc.Version, doc.Updated); r != nil {
+//		return r
+//	}
+func (c *Context) CheckConditions(etag string, lastModified time.Time) interface{} {
+	etag = quoteETag(etag)
+	code := checkConditions(c.Request, etag, lastModified)
+	if code == 0 {
+		return nil
+	}
+	if code == StatusNotModified && etag != "" {
+		c.ResponseHeader.Set("ETag", etag)
+	}
+	return conditionResult(code)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// etagWriter buffers the body of a 200 response to compute the ETag
+type etagWriter struct {
+	http.ResponseWriter
+
+	m *ETagMiddleware
+	r *http.Request
+
+	code      int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+	if code != StatusOK {
+		w.stop()
+	}
+}
+
+func (w *etagWriter) Write(p []byte) (int, error) {
+	if !w.buffering {
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf.Write(p)
+	if w.buf.Len() > w.m.MaxSize {
+		if err := w.stop(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush the buffered data, without ETag, for streamed results.
+func (w *etagWriter) Flush() {
+	if w.buffering {
+		w.stop()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	w.buffering = false
+	return h.Hijack()
+}
+
+// Tag the buffered body and write it, or 304 if it's not modified.
+func (w *etagWriter) Close() error {
+	if !w.buffering {
+		return nil
+	}
+	w.buffering = false
+
+	header := w.Header()
+	etag := header.Get("ETag")
+	if etag == "" && w.buf.Len() > 0 {
+		sum := sha256.Sum256(w.buf.Bytes())
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if w.m.Weak {
+			etag = "W/" + etag
+		}
+		header.Set("ETag", etag)
+	}
+
+	var modified time.Time
+	if lm := header.Get("Last-Modified"); lm != "" {
+		modified, _ = http.ParseTime(lm)
+	}
+
+	if checkConditions(w.r, etag, modified) == StatusNotModified {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(StatusNotModified)
+		return nil
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// write the buffered data and pass through
+func (w *etagWriter) stop() error {
+	w.buffering = false
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+var _ http.Flusher = (*etagWriter)(nil)
+var _ http.Hijacker = (*etagWriter)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Evaluate preconditions in the order of RFC 7232 section 6. It returns 0 if the request
+// should go on, StatusNotModified or StatusPreconditionFailed otherwise.
+func checkConditions(r *http.Request, etag string, modified time.Time) int {
+	h := r.Header
+	safe := r.Method == "GET" || r.Method == "HEAD"
+
+	if im := h.Get("If-Match"); im != "" {
+		if !matchETag(im, etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if ius := h.Get("If-Unmodified-Since"); ius != "" && !modified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && modified.Truncate(time.Second).After(t) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	if inm := h.Get("If-None-Match"); inm != "" {
+		if matchETag(inm, etag, false) {
+			if safe {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if ims := h.Get("If-Modified-Since"); ims != "" && safe && !modified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !modified.Truncate(time.Second).After(t) {
+			return StatusNotModified
+		}
+	}
+	return 0
+}
+
+// Check if the etag matches any of a list of entity tags, by the strong or weak comparison.
+func matchETag(list string, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	opaque := strings.TrimPrefix(etag, "W/")
+
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if strong {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// Quote an entity tag as a strong one if it's not quoted.
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+func resultVersion(result interface{}) (etag string, modified time.Time) {
+	if e, ok := result.(ETagger); ok {
+		etag = quoteETag(e.ETag())
+	}
+	if lm, ok := result.(LastModifier); ok {
+		modified = lm.LastModified()
+	}
+	return
+}
+
+func conditionResult(code int) interface{} {
+	if code == StatusNotModified {
+		return &Payload{Code: StatusNotModified}
+	}
+	return NewError("precondition failed", StatusPreconditionFailed).WithReason(ReasonPreconditionFailed)
+}
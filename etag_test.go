@@ -0,0 +1,117 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testDoc struct {
+	Name    string    `json:"name"`
+	Version string    `json:"-"`
+	Updated time.Time `json:"-"`
+}
+
+func (d *testDoc) ETag() string {
+	return d.Version
+}
+
+func (d *testDoc) LastModified() time.Time {
+	return d.Updated
+}
+
+func TestETag(t *testing.T) {
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc := &testDoc{Name: "gopher", Version: "v1", Updated: updated}
+
+	m := NewETagMiddleware()
+	m.Version = func(c *Context) (string, time.Time, error) {
+		return doc.Version, doc.Updated, nil
+	}
+
+	w := NewWeb()
+	w.Append(m)
+	w.Handle("GET", "/list", func(c *Context) interface{} {
+		return []int{1, 2, 3}
+	})
+	w.Handle("GET", "/doc", func(c *Context) interface{} {
+		return doc
+	})
+	w.Handle("PUT", "/doc", func(c *Context) interface{} {
+		return doc
+	})
+	w.Handle("DELETE", "/doc", func(c *Context) interface{} {
+		if r := c.CheckConditions("v2", time.Time{}); r != nil {
+			return r
+		}
+		return nil
+	}).Remove("etag")
+
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// computed etag
+	rec := do("GET", "/list")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != StatusOK || etag == "" || rec.Body.String() != "[1,2,3]" {
+		t.Fatalf("code = %d, etag = %q, body = %s", rec.Code, etag, rec.Body)
+	}
+	rec = do("GET", "/list", "If-None-Match", `"other", `+etag)
+	if rec.Code != StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+		t.Errorf("code = %d, body = %s; want 304", rec.Code, rec.Body)
+	}
+	rec = do("GET", "/list", "If-None-Match", `"other"`)
+	if rec.Code != StatusOK {
+		t.Errorf("code = %d; want 200", rec.Code)
+	}
+
+	// etag and last modified of the result
+	rec = do("GET", "/doc")
+	if e := rec.Header().Get("ETag"); e != `"v1"` {
+		t.Errorf("ETag = %q", e)
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != updated.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q", lm)
+	}
+	rec = do("GET", "/doc", "If-None-Match", `W/"v1"`)
+	if rec.Code != StatusNotModified {
+		t.Errorf("code = %d; want 304 by weak comparison", rec.Code)
+	}
+	rec = do("GET", "/doc", "If-Modified-Since", updated.Format(http.TimeFormat))
+	if rec.Code != StatusNotModified {
+		t.Errorf("code = %d; want 304 by If-Modified-Since", rec.Code)
+	}
+	rec = do("GET", "/doc", "If-Modified-Since", updated.Add(-time.Hour).Format(http.TimeFormat))
+	if rec.Code != StatusOK {
+		t.Errorf("code = %d; want 200", rec.Code)
+	}
+
+	// preconditions
+	for _, c := range []struct {
+		method string
+		header []string
+		code   int
+	}{
+		{"PUT", []string{"If-Match", `"v1"`}, StatusOK},
+		{"PUT", []string{"If-Match", `*`}, StatusOK},
+		{"PUT", []string{"If-Match", `"v0"`}, StatusPreconditionFailed},
+		{"PUT", []string{"If-Match", `W/"v1"`}, StatusPreconditionFailed},
+		{"PUT", []string{"If-Unmodified-Since", updated.Add(-time.Hour).Format(http.TimeFormat)}, StatusPreconditionFailed},
+		{"PUT", nil, StatusOK},
+		{"DELETE", []string{"If-Match", `"v2"`}, StatusOK},
+		{"DELETE", []string{"If-Match", `"v1"`}, StatusPreconditionFailed},
+	} {
+		rec = do(c.method, "/doc", c.header...)
+		if rec.Code != c.code {
+			t.Errorf("%s %v: code = %d; want %d", c.method, c.header, rec.Code, c.code)
+		}
+	}
+}
@@ -4,17 +4,8 @@ import (
 	"github.com/tiaotiao/web"
 )
 
-type Api struct {
-	MessageMgr *MessageManager
-}
-
-func NewApi() *Api {
-	a := new(Api)
-	a.MessageMgr = NewMessageManager()
-	return a
-}
-
-func (a *Api) PostMessage(c *web.Context) interface{} {
+// The *MessageManager of handlers is provided in Server.init, see Web.Provide.
+func PostMessage(c *web.Context, mgr *MessageManager) interface{} {
 	args := struct {
 		Message string `web:"message,required"` // required
 		Remark  string `web:"remark"`           // not required
@@ -25,7 +16,7 @@ func (a *Api) PostMessage(c *web.Context) interface{} {
 		return err // bad requrest error
 	}
 
-	msg := a.MessageMgr.Add(args.Message, args.Remark)
+	msg := mgr.Add(args.Message, args.Remark)
 	if msg == nil {
 		return "failed" // return a string
 	}
@@ -33,22 +24,22 @@ func (a *Api) PostMessage(c *web.Context) interface{} {
 	return msg // return a struct
 }
 
-func (a *Api) GetMessage(c *web.Context, args struct {
+func GetMessage(c *web.Context, args struct {
 	Id int64 `web:"id,required"`
-}) interface{} { // scheme args automatically
+}, mgr *MessageManager) interface{} { // scheme args automatically
 
-	msg := a.MessageMgr.Get(args.Id)
+	msg := mgr.Get(args.Id)
 	if msg == nil {
 		return web.NewError("msg not found", web.StatusNotFound) // new error
 	}
 	return msg
 }
 
-func (a *Api) GetMessages(c *web.Context, args struct {
+func GetMessages(c *web.Context, args struct {
 	Limit int `web:"limit,20"` // with default value
-}) interface{} {
+}, mgr *MessageManager) interface{} {
 
-	msgs := a.MessageMgr.List()
+	msgs := mgr.List()
 
 	total := len(msgs)
 	if total > args.Limit {
@@ -11,14 +11,12 @@ import (
 type Server struct {
 	addr string
 	web  *web.Web
-	api  *Api
 }
 
 func NewServer(addr string) *Server {
 	s := new(Server)
 	s.addr = addr
 	s.web = web.NewWeb()
-	s.api = NewApi()
 	return s
 }
 
@@ -36,13 +34,14 @@ func (s *Server) Run() error {
 
 func (s *Server) init() {
 	s.web.SetLogger(s)
+	s.web.Provide(NewMessageManager()) // injected into handlers, before registering them
 	s.registerURLs()
 }
 
 func (s *Server) registerURLs() {
-	s.web.Handle("GET", "/api/message", s.api.GetMessage)
-	s.web.Handle("GET", "/api/message/list", s.api.GetMessages)
-	s.web.Handle("GET", "/api/message/add", s.api.PostMessage)
+	s.web.Handle("GET", "/api/message", GetMessage)
+	s.web.Handle("GET", "/api/message/list", GetMessages)
+	s.web.Handle("GET", "/api/message/add", PostMessage)
 }
 
 func (s *Server) OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
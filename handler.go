@@ -8,23 +8,36 @@ import (
 	"time"
 )
 
+// Handler is a func of one of the forms:
+//
+//	func(c *Context) interface{}
+//	func(c *Context, args Args) interface{}
+//	func(c *Context, args Args, db *sql.DB, user *User) interface{}
+//
+// Args is a struct schemed from params, see Scheme. Other args are injected by providers,
+// see Web.Provide, which must be registered before Handle.
 type Handler interface{}
 
 ///////////////////////////////////////////////////////////////////////////////
 
 type handler struct {
-	fn Handler
+	fn    Handler
+	route string
 
 	reflectFn      reflect.Value
 	reflectArgType reflect.Type
+	deps           []*provider // of args after *Context and Args
 
 	midds *MiddlewaresManager
 
-	responser Responser
-	logger    Logger
+	responser  Responser
+	logger     Logger
+	decoders   map[string]Decoder
+	precedence []string
+	onPanic    func(c *Context, v interface{}, stack []byte)
 }
 
-func newHandler(fn Handler, midds *MiddlewaresManager, responser Responser, logger Logger) *handler {
+func newHandler(fn Handler, midds *MiddlewaresManager, responser Responser, logger Logger, providers map[reflect.Type]*provider) *handler {
 	h := new(handler)
 
 	if fn == nil {
@@ -41,7 +54,7 @@ func newHandler(fn Handler, midds *MiddlewaresManager, responser Responser, logg
 
 	h.logger = logger
 
-	err := h.validateHandler(fn)
+	err := h.validateHandler(fn, providers)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -51,33 +64,56 @@ func newHandler(fn Handler, midds *MiddlewaresManager, responser Responser, logg
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var err error
+	var c *Context
 	var result interface{}
 	var start = time.Now()
 
 	defer func() {
-		used := time.Since(start)
-
 		// response
-		code, err := h.responser.Response(w, result)
+		rw := w
+		if c != nil {
+			rw = c.ResponseWriter // may be wrapped by middlewares
+		}
+		code, err := h.response(c, rw, result)
 		if err != nil {
 			result = err
 		}
+		if c != nil {
+			r = c.Request // with the request id and parsed forms
+			c.responsedErr, _ = result.(error)
+			c.runDefers()
+			if st := c.ResponseState(); st.HeaderSent {
+				code = st.Status // what is actually sent
+			}
+		}
+
+		used := time.Since(start) // including the time of writing, for streams like SSE
 
 		if h.logger != nil {
-			h.logger.OnLog(r, start, used, code, result)
+			onLog(h.logger, c, r, start, used, code, result)
 		}
 	}()
 
 	// new context
-	c, err := newContext(w, r)
+	c, err = newContext(w, r)
+	c.Route = h.route
+	if sl, ok := h.logger.(*SlogLogger); ok {
+		c.slog = sl.Logger
+	}
 	if err != nil {
+		h.midds.serveRejects(c, err)
 		result = err
 		return
 	}
 
 	// parse params
+	c.decoders = h.decoders
+	c.responser = h.responser
+	c.precedence = h.precedence
+	c.onPanic = h.onPanic
 	err = ParseParams(c)
 	if err != nil {
+		h.midds.serveRejects(c, err)
 		result = err
 		return
 	}
@@ -86,11 +122,32 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// Write the result by the responser. Callbacks run by it, such as of SSE, Stream and
+// WebSocket, may panic, which is responsed as a server error if nothing is written yet.
+func (h *handler) response(c *Context, w http.ResponseWriter, result interface{}) (code int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			e := recovered(c, e)
+			code, err = StatusInternalServerError, e
+			var st ResponseState
+			if c != nil {
+				st = c.ResponseState()
+			}
+			if !st.HeaderSent && !st.Hijacked {
+				func() {
+					defer func() { recover() }() // give up if the responser itself panics
+					code, _ = response(h.responser, c, w, e)
+				}()
+			}
+		}
+	}()
+	return response(h.responser, c, w, result)
+}
+
 func (h *handler) serve(c *Context) (result interface{}) {
 	defer func() {
 		if e := recover(); e != nil {
-			s := fmt.Sprintf("Panic: %v\n %v", e, debug.Stack())
-			result = NewErrorMsg("server error", s, StatusInternalServerError)
+			result = recovered(c, e)
 		}
 	}()
 
@@ -101,20 +158,24 @@ func (h *handler) serve(c *Context) (result interface{}) {
 	}
 
 	// call
-	result = h.call(c)
+	if c.timeout != nil {
+		result = h.callTimeout(c)
+	} else {
+		result = h.call(c)
+	}
 
 	return h.midds.serveResponses(c, result)
 }
 
 func (h *handler) call(c *Context) (result interface{}) {
-	var in = make([]reflect.Value, 0, 2)
+	var in = make([]reflect.Value, 0, 2+len(h.deps))
 
 	in = append(in, reflect.ValueOf(c))
 
 	if h.reflectArgType != nil {
 		arg := reflect.New(h.reflectArgType)
 
-		err := Scheme(c.Values, arg.Interface()) // auto scheme
+		err := c.Scheme(arg.Interface()) // auto scheme
 		if err != nil {
 			return err
 		}
@@ -122,12 +183,20 @@ func (h *handler) call(c *Context) (result interface{}) {
 		in = append(in, arg.Elem())
 	}
 
+	for _, p := range h.deps {
+		v, err := p.provide(c)
+		if err != nil {
+			return err
+		}
+		in = append(in, v)
+	}
+
 	outs := h.reflectFn.Call(in)
 
 	return outs[0].Interface()
 }
 
-func (h *handler) validateHandler(fn Handler) error {
+func (h *handler) validateHandler(fn Handler, providers map[reflect.Type]*provider) error {
 	v := reflect.ValueOf(fn)
 	t := reflect.TypeOf(fn)
 
@@ -135,24 +204,32 @@ func (h *handler) validateHandler(fn Handler) error {
 		return fmt.Errorf("not func type, %v", t.String())
 	}
 
-	if (t.NumIn() != 1 && t.NumIn() != 2) || t.NumOut() != 1 {
+	if t.NumIn() < 1 || t.NumOut() != 1 {
 		return fmt.Errorf("invalid num of args, %v", t.String())
 	}
 
 	// the first arg must be *Context
 	ctxArg := t.In(0)
-	ctxType := reflect.TypeOf(new(Context))
-	if ctxArg != ctxType {
+	if ctxArg != contextType {
 		return fmt.Errorf("The first input arg must be *Context, %v", t.String())
 	}
 
-	// if there is the second arg, it must be a struct
-	if t.NumIn() == 2 {
-		arg := t.In(1)
-		if arg.Kind() != reflect.Struct {
+	// the second arg can be a struct of params, others must be provided
+	h.deps = nil
+	for i := 1; i < t.NumIn(); i++ {
+		arg := t.In(i)
+		if p, ok := providers[arg]; ok {
+			h.deps = append(h.deps, p)
+			continue
+		}
+		if i == 1 && arg.Kind() == reflect.Struct {
+			h.reflectArgType = arg
+			continue
+		}
+		if i == 1 && t.NumIn() == 2 {
 			return fmt.Errorf("The arg must be a struct, %v", t.String())
 		}
-		h.reflectArgType = arg
+		return fmt.Errorf("No provider of arg %v, %v", arg, t.String())
 	}
 
 	// output must be an interface{}
@@ -166,3 +243,36 @@ func (h *handler) validateHandler(fn Handler) error {
 
 	return nil
 }
+
+// Convert a recovered panic into an *Error, which responses nothing about the panic
+// unless in debug mode. The panic is reported to the OnPanic hook of Web.
+func recovered(c *Context, v interface{}) *Error {
+	return recoveredStack(c, v, debug.Stack())
+}
+
+func recoveredStack(c *Context, v interface{}, stack []byte) *Error {
+	if c != nil {
+		c.panics++
+	}
+	if c != nil && c.onPanic != nil {
+		func() {
+			defer func() { recover() }() // the hook must not break the response
+			c.onPanic(c, v, stack)
+		}()
+	}
+
+	return NewError("server error", StatusInternalServerError).WithReason(ReasonInternal).Wrap(&PanicError{Value: v, Stack: stack})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// PanicError is a panic recovered from a handler or middleware, wrapped by the *Error
+// responsed. Use errors.As to get it in a Logger.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", p.Value, p.Stack)
+}
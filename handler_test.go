@@ -2,6 +2,7 @@ package web
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -48,7 +49,7 @@ func TestServeHttp(t *testing.T) {
 
 	tal := testLogger{}
 
-	wh := newHandler(th.Get, mm, new(DefaultResponser), tal)
+	wh := newHandler(th.Get, mm, new(DefaultResponser), tal, nil)
 	rw := httptest.NewRecorder()
 	r, err := http.NewRequest("GET", "http://local/test", strings.NewReader("t1=v1"))
 	checkErr(err)
@@ -61,3 +62,169 @@ func TestServeHttp(t *testing.T) {
 		t.Errorf("responseBody=%s; want %s", rspD, wantD)
 	}
 }
+
+type testPanicMiddleware struct {
+	where string
+}
+
+func (m *testPanicMiddleware) ServeMiddleware(c *Context) error {
+	if m.where == "middleware" {
+		panic("middleware boom")
+	}
+	return nil
+}
+
+func (m *testPanicMiddleware) ServeResponse(c *Context, result interface{}) (interface{}, error) {
+	if m.where == "response" {
+		panic("response boom")
+	}
+	return result, nil
+}
+
+func TestPanic(t *testing.T) {
+	var panics []interface{}
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.OnPanic(func(c *Context, v interface{}, stack []byte) {
+		if c == nil || len(stack) == 0 {
+			t.Errorf("OnPanic: c = %v, stack = %s", c, stack)
+		}
+		panics = append(panics, v)
+	})
+	w.Handle("GET", "/handler", func(c *Context) interface{} {
+		panic("handler boom")
+	})
+	w.Handle("GET", "/middleware", func(c *Context) interface{} {
+		return "ok"
+	}).Append(&testPanicMiddleware{"middleware"})
+	w.Handle("GET", "/response", func(c *Context) interface{} {
+		return "ok"
+	}).Append(&testPanicMiddleware{"response"})
+
+	for _, path := range []string{"/handler", "/middleware", "/response"} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-Request-Id", "req-1")
+		w.ServeHTTP(rec, r)
+
+		want := `{"error":"server error","reason":"internal","request_id":"req-1"}`
+		if rec.Code != StatusInternalServerError || rec.Body.String() != want {
+			t.Errorf("%s: code = %d, body = %s; want %s", path, rec.Code, rec.Body, want)
+		}
+	}
+	if fmt.Sprint(panics) != "[handler boom middleware boom response boom]" {
+		t.Errorf("panics = %v", panics)
+	}
+
+	// details in debug mode
+	Debug = true
+	defer func() { Debug = false }()
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/handler", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "panic: handler boom") || !strings.Contains(body, "goroutine") {
+		t.Errorf("debug body = %s", body)
+	}
+}
+
+type testStateLogger struct {
+	code  int
+	state ResponseState
+}
+
+func (l *testStateLogger) OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
+}
+
+func (l *testStateLogger) OnLogContext(c *Context, start time.Time, used time.Duration, code int, result interface{}) {
+	l.code = code
+	l.state = c.ResponseState()
+}
+
+func TestResponseState(t *testing.T) {
+	logger := new(testStateLogger)
+
+	w := NewWeb()
+	w.SetLogger(logger)
+	w.Handle("GET", "/direct", func(c *Context) interface{} {
+		if _, ok := c.ResponseWriter.(http.Flusher); !ok {
+			t.Errorf("http.Flusher is not kept")
+		}
+		rf, ok := c.ResponseWriter.(io.ReaderFrom)
+		if !ok {
+			t.Fatalf("io.ReaderFrom is not kept")
+		}
+		c.ResponseWriter.WriteHeader(http.StatusTeapot)
+		rf.ReadFrom(strings.NewReader("short and stout"))
+		return nil
+	})
+	w.Handle("GET", "/result", func(c *Context) interface{} {
+		return "ok"
+	})
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/direct", nil))
+	if rec.Code != http.StatusTeapot || logger.code != http.StatusTeapot {
+		t.Errorf("code = %d, logged %d; want %d", rec.Code, logger.code, http.StatusTeapot)
+	}
+	if st := logger.state; !st.HeaderSent || st.Status != http.StatusTeapot || st.Bytes != 15 || st.FirstByte <= 0 {
+		t.Errorf("state = %+v", st)
+	}
+
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/result", nil))
+	if st := logger.state; logger.code != StatusOK || st.Status != StatusOK || st.Bytes != 2 {
+		t.Errorf("code = %d, state = %+v", logger.code, st)
+	}
+}
+
+func TestPanicInResponse(t *testing.T) {
+	var panics []interface{}
+
+	m := NewMetricsMiddleware()
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(m)
+	w.OnPanic(func(c *Context, v interface{}, stack []byte) {
+		panics = append(panics, v)
+	})
+	w.Handle("GET", "/stream", func(c *Context) interface{} {
+		return Stream(func() (interface{}, bool, error) {
+			panic("stream boom")
+		})
+	})
+	w.Handle("GET", "/sse", func(c *Context) interface{} {
+		return SSE(func(s *SSEStream) error {
+			panic("sse boom")
+		})
+	})
+	w.Handle("GET", "/result", func(c *Context) interface{} {
+		return testPanicWriteable{}
+	})
+
+	for _, path := range []string{"/stream", "/sse", "/result"} {
+		rec := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					t.Errorf("%s: panic escaped: %v", path, e)
+				}
+			}()
+			w.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		}()
+		if path == "/result" && (rec.Code != StatusInternalServerError || !strings.Contains(rec.Body.String(), `"error":"server error"`)) {
+			t.Errorf("%s: code = %d, body = %s", path, rec.Code, rec.Body)
+		}
+	}
+	if fmt.Sprint(panics) != "[stream boom sse boom result boom]" {
+		t.Errorf("panics = %v", panics)
+	}
+	if body := string(m.Expose()); !strings.Contains(body, `web_http_panics_total{method="GET",route="/stream"} 1`) {
+		t.Errorf("panics not counted:\n%s", body)
+	}
+}
+
+type testPanicWriteable struct{}
+
+func (testPanicWriteable) OnWrite(w http.ResponseWriter) error {
+	panic("result boom")
+}
@@ -11,6 +11,20 @@ type Logger interface {
 	OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{})
 }
 
+// ContextLogger is a Logger which needs the context, such as for the request id and the route.
+// If a Logger implements it, OnLogContext is called instead of OnLog once the context is created.
+type ContextLogger interface {
+	OnLogContext(c *Context, start time.Time, used time.Duration, code int, result interface{})
+}
+
+func onLog(l Logger, c *Context, r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
+	if cl, ok := l.(ContextLogger); ok && c != nil {
+		cl.OnLogContext(c, start, used, code, result)
+		return
+	}
+	l.OnLog(r, start, used, code, result)
+}
+
 type StdLogger struct {
 }
 
@@ -18,19 +32,37 @@ func NewStdLogger() *StdLogger {
 	return new(StdLogger)
 }
 
+// The query, params of POST and the result are logged, redacted by Redaction.
 func (l *StdLogger) OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
 	var post string
 	if r.Method == "POST" {
+		params := make(map[string]interface{}, len(r.PostForm))
 		for k, v := range r.PostForm {
-			if post != "" {
-				post += "&"
-			}
-			post += fmt.Sprintf("%s=%s", k, strings.Join(v, ","))
-		}
-		if post != "" {
-			post = " " + post
+			params[k] = strings.Join(v, ",")
 		}
-		post = strings.Replace(post, "\n", " ", -1)
+		post = Redaction.Params(params)
 	}
-	fmt.Printf("[%s] %3d - %4s %s%s - %dns %v\n", start.Format("01/02 15:04:05"), code, r.Method, r.RequestURI, post, used, result)
+	l.log(r.Method, Redaction.RequestURI(r), RequestIdFromContext(r.Context()), start, used, code, post, result)
 }
+
+func (l *StdLogger) OnLogContext(c *Context, start time.Time, used time.Duration, code int, result interface{}) {
+	var post string
+	secrets := c.secretKeys()
+	if c.Request.Method == "POST" {
+		post = Redaction.params(c.params[LocationBody], secrets)
+	}
+	l.log(c.Request.Method, Redaction.requestURI(c.Request, secrets), c.RequestId, start, used, code, post, result)
+}
+
+func (l *StdLogger) log(method, uri string, requestId string, start time.Time, used time.Duration, code int, post string, result interface{}) {
+	if post != "" {
+		post = " " + post
+	}
+	if requestId != "" {
+		requestId = " " + requestId
+	}
+	fmt.Printf("[%s]%s %3d - %4s %s%s - %dns %v\n", start.Format("01/02 15:04:05"), requestId, code, method, uri, post, used, Redaction.Result(result))
+}
+
+var _ Logger = (*StdLogger)(nil)
+var _ ContextLogger = (*StdLogger)(nil)
@@ -0,0 +1,263 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default buckets of request latency in seconds, and of request and response sizes in bytes.
+var (
+	MetricsLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	MetricsSizeBuckets    = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+// MetricsMiddleware records metrics of requests per method and route template, and exposes
+// them in the Prometheus text format:
+//
+//	web_http_requests_total{method,route,code}       requests by status class, such as "2xx"
+//	web_http_request_duration_seconds{method,route}  histogram of latency since received
+//	web_http_requests_in_flight{method,route}        requests being served
+//	web_http_request_size_bytes{method,route}        histogram of body sizes of requests as received
+//	web_http_response_size_bytes{method,route}       histogram of body sizes of responses
+//	web_http_panics_total{method,route}              panics recovered
+//
+// The route is the path pattern registered, such as "/users/{id}", so the cardinality is
+// bounded. Append it before other middlewares to count requests they reject. Requests rejected
+// before middlewares, such as for an unsupported body, are counted too. To use it:
+//
+//	m := web.NewMetricsMiddleware()
+//	w.Append(m)
+//	w.Handle("GET", "/metrics", m.Serve).Remove("metrics")
+type MetricsMiddleware struct {
+	Namespace      string    // prefix of metric names, "web" by default
+	LatencyBuckets []float64 // MetricsLatencyBuckets if nil
+	SizeBuckets    []float64 // MetricsSizeBuckets if nil
+
+	routes map[routeKey]*routeMetrics
+	lock   sync.Mutex
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type routeMetrics struct {
+	requests map[string]uint64 // status class -> count
+	inFlight int64
+	panics   uint64
+
+	duration *histogram
+	reqSize  *histogram
+	respSize *histogram
+}
+
+func NewMetricsMiddleware() *MetricsMiddleware {
+	m := new(MetricsMiddleware)
+	m.Namespace = "web"
+	m.routes = make(map[routeKey]*routeMetrics)
+	return m
+}
+
+func (m *MetricsMiddleware) Name() string {
+	return "metrics"
+}
+
+func (m *MetricsMiddleware) ServeMiddleware(c *Context) error {
+	key := routeKey{c.Request.Method, c.Route}
+
+	m.lock.Lock()
+	m.route(key).inFlight++
+	m.lock.Unlock()
+
+	c.Defer(func() {
+		st := c.ResponseState()
+		code := st.Status
+		if !st.HeaderSent {
+			code = StatusOK // nothing written, net/http responses 200
+		}
+
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		rm := m.route(key)
+		rm.inFlight--
+		rm.requests[statusClass(code)]++
+		rm.panics += uint64(c.panics)
+		rm.duration.observe(time.Since(c.start).Seconds()) // since received, whatever the order of middlewares
+		rm.reqSize.observe(float64(c.bodySize))            // as received, before decompressed
+		rm.respSize.observe(float64(st.Bytes))
+	})
+	return nil
+}
+
+// Count a request rejected before middlewares, such as 415 for an unsupported body.
+func (m *MetricsMiddleware) ServeReject(c *Context, err error) {
+	m.ServeMiddleware(c)
+}
+
+// A Handler to expose metrics.
+func (m *MetricsMiddleware) Serve(c *Context) interface{} {
+	return Raw("text/plain; version=0.0.4; charset=utf-8", m.Expose())
+}
+
+// Expose metrics on a separate server, such as an internal port.
+func (m *MetricsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.Expose())
+}
+
+// Get metrics in the Prometheus text exposition format.
+func (m *MetricsMiddleware) Expose() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]routeKey, 0, len(m.routes))
+	for k := range m.routes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	var b bytes.Buffer
+	name := m.metricName
+
+	writeMetricHeader(&b, name("http_requests_total"), "counter", "Total number of HTTP requests by status class.")
+	for _, k := range keys {
+		requests := m.routes[k].requests
+		classes := make([]string, 0, len(requests))
+		for class := range requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(&b, "%s{%s,code=%q} %d\n", name("http_requests_total"), k.labels(), class, requests[class])
+		}
+	}
+
+	writeMetricHeader(&b, name("http_request_duration_seconds"), "histogram", "Latency of HTTP requests in seconds.")
+	for _, k := range keys {
+		m.routes[k].duration.write(&b, name("http_request_duration_seconds"), k.labels())
+	}
+
+	writeMetricHeader(&b, name("http_requests_in_flight"), "gauge", "Number of HTTP requests being served.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s{%s} %d\n", name("http_requests_in_flight"), k.labels(), m.routes[k].inFlight)
+	}
+
+	writeMetricHeader(&b, name("http_request_size_bytes"), "histogram", "Body sizes of HTTP requests in bytes.")
+	for _, k := range keys {
+		m.routes[k].reqSize.write(&b, name("http_request_size_bytes"), k.labels())
+	}
+
+	writeMetricHeader(&b, name("http_response_size_bytes"), "histogram", "Body sizes of HTTP responses in bytes.")
+	for _, k := range keys {
+		m.routes[k].respSize.write(&b, name("http_response_size_bytes"), k.labels())
+	}
+
+	writeMetricHeader(&b, name("http_panics_total"), "counter", "Total number of panics recovered.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s{%s} %d\n", name("http_panics_total"), k.labels(), m.routes[k].panics)
+	}
+
+	return b.Bytes()
+}
+
+// get or create metrics of the route, must be locked
+func (m *MetricsMiddleware) route(key routeKey) *routeMetrics {
+	rm, ok := m.routes[key]
+	if !ok {
+		latency, size := m.LatencyBuckets, m.SizeBuckets
+		if latency == nil {
+			latency = MetricsLatencyBuckets
+		}
+		if size == nil {
+			size = MetricsSizeBuckets
+		}
+		rm = &routeMetrics{
+			requests: make(map[string]uint64),
+			duration: newHistogram(latency),
+			reqSize:  newHistogram(size),
+			respSize: newHistogram(size),
+		}
+		m.routes[key] = rm
+	}
+	return rm
+}
+
+func (m *MetricsMiddleware) metricName(name string) string {
+	if m.Namespace == "" {
+		return name
+	}
+	return m.Namespace + "_" + name
+}
+
+func (k routeKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\"", escapeLabel(k.method), escapeLabel(k.route))
+}
+
+var _ Middleware = (*MetricsMiddleware)(nil)
+var _ RejectMiddleware = (*MetricsMiddleware)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+type histogram struct {
+	buckets []float64 // upper bounds, sorted
+	counts  []uint64  // not cumulative, the last one is +Inf
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	h := new(histogram)
+	h.buckets = append([]float64(nil), buckets...)
+	sort.Float64s(h.buckets)
+	h.counts = make([]uint64, len(h.buckets)+1)
+	return h
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // the first bucket >= v
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(b *bytes.Buffer, name string, labels string) {
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func writeMetricHeader(b *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetricsMiddleware()
+	m.LatencyBuckets = []float64{0.5, 1}
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(m)
+	w.Handle("GET", "/users/{id}", func(c *Context) interface{} {
+		if c.Values["id"] == "0" {
+			return NewError("not found", StatusNotFound)
+		}
+		return "user"
+	})
+	w.Handle("POST", "/users", func(c *Context) interface{} {
+		panic("boom")
+	})
+	w.Handle("GET", "/metrics", m.Serve).Remove("metrics")
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+		w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader("name=x")))
+
+	r := httptest.NewRequest("POST", "/users", strings.NewReader("x"))
+	r.Header.Set("Content-Type", "application/unknown") // 415 before middlewares
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE web_http_requests_total counter",
+		`web_http_requests_total{method="GET",route="/users/{id}",code="2xx"} 2`,
+		`web_http_requests_total{method="GET",route="/users/{id}",code="4xx"} 1`,
+		`web_http_requests_total{method="POST",route="/users",code="5xx"} 1`,
+		`web_http_requests_total{method="POST",route="/users",code="4xx"} 1`,
+		"# TYPE web_http_request_duration_seconds histogram",
+		`web_http_request_duration_seconds_bucket{method="GET",route="/users/{id}",le="1"} 3`,
+		`web_http_request_duration_seconds_bucket{method="GET",route="/users/{id}",le="+Inf"} 3`,
+		`web_http_request_duration_seconds_count{method="GET",route="/users/{id}"} 3`,
+		`web_http_requests_in_flight{method="GET",route="/users/{id}"} 0`,
+		`web_http_request_size_bytes_sum{method="POST",route="/users"} 7`,
+		`web_http_response_size_bytes_bucket{method="GET",route="/users/{id}",le="256"} 3`,
+		`web_http_panics_total{method="POST",route="/users"} 1`,
+		`web_http_panics_total{method="GET",route="/users/{id}"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	if strings.Contains(body, `route="/metrics"`) || strings.Contains(body, "/users/1") {
+		t.Errorf("unexpected routes:\n%s", body)
+	}
+}
+
+type testSleepMiddleware time.Duration
+
+func (m testSleepMiddleware) ServeMiddleware(c *Context) error {
+	time.Sleep(time.Duration(m))
+	return nil
+}
+
+func TestMetricsSinceReceived(t *testing.T) {
+	m := NewMetricsMiddleware()
+	m.LatencyBuckets = []float64{0.02}
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(testSleepMiddleware(30 * time.Millisecond)) // before metrics
+	w.Append(m)
+	w.Handle("POST", "/users", func(c *Context) interface{} {
+		return "ok"
+	})
+
+	var body bytes.Buffer
+	gw := gzip.NewWriter(&body)
+	gw.Write([]byte(strings.Repeat("name=x&", 100)))
+	gw.Close()
+	size := body.Len()
+
+	r := httptest.NewRequest("POST", "/users", &body)
+	r.Header.Set("Content-Encoding", "gzip")
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	exposed := string(m.Expose())
+	for _, line := range []string{
+		`web_http_request_duration_seconds_bucket{method="POST",route="/users",le="0.02"} 0`,
+		fmt.Sprintf(`web_http_request_size_bytes_sum{method="POST",route="/users"} %d`, size),
+	} {
+		if !strings.Contains(exposed, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, exposed)
+		}
+	}
+}
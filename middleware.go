@@ -1,10 +1,5 @@
 package web
 
-import (
-	"fmt"
-	"runtime/debug"
-)
-
 type Middleware interface {
 	ServeMiddleware(c *Context) error
 }
@@ -13,6 +8,13 @@ type ResponseMiddleware interface {
 	ServeResponse(c *Context, result interface{}) (interface{}, error)
 }
 
+// RejectMiddleware is notified of a request rejected before middlewares are served, such as
+// for an invalid body or params, so that metrics and traces still cover it. Its Defer-ed
+// functions are called after the error is responsed.
+type RejectMiddleware interface {
+	ServeReject(c *Context, err error)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 type MiddlewaresManager struct {
@@ -33,16 +35,33 @@ func (m *MiddlewaresManager) Append(midd Middleware) *MiddlewaresManager {
 	return m
 }
 
+// Remove middlewares by name, which is got from the Name() method of middleware.
+// It only affects this manager, for example to opt out a middleware of the router for a route:
+//
+//	w.Handle("GET", "/download", Download).Remove("compress")
+func (m *MiddlewaresManager) Remove(name string) *MiddlewaresManager {
+	midds := m.midds[:0]
+	for _, midd := range m.midds {
+		if n, ok := midd.(interface{ Name() string }); ok && n.Name() == name {
+			continue
+		}
+		midds = append(midds, midd)
+	}
+	m.midds = midds
+	return m
+}
+
+// Copy the middlewares, for a route or a sub router to be independent of this one.
 func (m *MiddlewaresManager) duplicate() *MiddlewaresManager {
 	d := newMiddlewaresManager()
-	copy(d.midds, m.midds)
+	d.midds = append(d.midds, m.midds...)
 	return d
 }
 
 func (m *MiddlewaresManager) serveMiddlewares(c *Context) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = NewErrorMsg("server error", fmt.Sprintf("Panic: %v\n%v", e, debug.Stack()), StatusInternalServerError)
+			err = recovered(c, e)
 		}
 	}()
 
@@ -58,7 +77,7 @@ func (m *MiddlewaresManager) serveMiddlewares(c *Context) (err error) {
 func (m *MiddlewaresManager) serveResponses(c *Context, r interface{}) (rt interface{}) {
 	defer func() {
 		if e := recover(); e != nil {
-			rt = NewErrorMsg("server error", fmt.Sprintf("Panic: %v", e, debug.Stack()), StatusInternalServerError)
+			rt = recovered(c, e)
 		}
 	}()
 
@@ -73,3 +92,14 @@ func (m *MiddlewaresManager) serveResponses(c *Context, r interface{}) (rt inter
 	}
 	return r
 }
+
+func (m *MiddlewaresManager) serveRejects(c *Context, err error) {
+	for _, midd := range m.midds {
+		if rm, ok := midd.(RejectMiddleware); ok {
+			func() {
+				defer func() { recover() }() // the error is responsed anyway
+				rm.ServeReject(c, err)
+			}()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NegotiatingResponser chooses an Encoder by the Accept header of request, with q-values
+// and wildcards. JSON, XML, MessagePack, CSV and YAML are registered by default. JSON is
+// chosen if there is no Accept header. It responses 406 Not Acceptable if no encoder matches,
+// except that errors are encoded by the first encoder which can encode them, to keep the status.
+//
+// Like DefaultResponser, string, []byte and Writeable are written directly, and an error is
+// responsed as *Error. To use it:
+//
+//	w.SetResponser(web.NewNegotiatingResponser())
+type NegotiatingResponser struct {
+	mediaTypes []string
+	encoders   map[string]Encoder
+}
+
+func NewNegotiatingResponser() *NegotiatingResponser {
+	r := new(NegotiatingResponser)
+	r.encoders = make(map[string]Encoder)
+
+	r.RegisterEncoder(MediaTypeJSON, new(JSONEncoder))
+	r.RegisterEncoder(MediaTypeXML, new(XMLEncoder))
+	r.RegisterEncoder(MediaTypeTextXML, new(XMLEncoder))
+	r.RegisterEncoder(MediaTypeMsgpack, new(MsgpackEncoder))
+	r.RegisterEncoder("application/x-msgpack", new(MsgpackEncoder))
+	r.RegisterEncoder(MediaTypeCSV, new(CSVEncoder))
+	r.RegisterEncoder(MediaTypeYAML, new(YAMLEncoder))
+	r.RegisterEncoder("text/yaml", new(YAMLEncoder))
+	return r
+}
+
+// Register an encoder for this media type. Media types registered earlier are preferred
+// if the client accepts them equally. A nil encoder removes the media type.
+func (r *NegotiatingResponser) RegisterEncoder(mediaType string, e Encoder) {
+	mediaType = strings.ToLower(mediaType)
+
+	for i, t := range r.mediaTypes {
+		if t == mediaType {
+			r.mediaTypes = append(r.mediaTypes[:i], r.mediaTypes[i+1:]...)
+			break
+		}
+	}
+	delete(r.encoders, mediaType)
+
+	if e != nil {
+		r.mediaTypes = append(r.mediaTypes, mediaType)
+		r.encoders[mediaType] = e
+	}
+}
+
+// Response without request, the first encoder is used.
+func (r *NegotiatingResponser) Response(w http.ResponseWriter, result interface{}) (int, error) {
+	return r.response(nil, w, "", result)
+}
+
+func (r *NegotiatingResponser) ResponseContext(c *Context, result interface{}) (int, error) {
+	return r.response(c, c.ResponseWriter, c.Request.Header.Get("Accept"), result)
+}
+
+func (r *NegotiatingResponser) response(c *Context, w http.ResponseWriter, accept string, result interface{}) (int, error) {
+	setHeaders(w, result)
+
+	result, code := statusResult(result)
+
+	if ok, code, err := writeDirect(c, w, code, result); ok {
+		return code, err
+	}
+
+	e := r.negotiate(accept, result)
+	if e == nil && code >= 400 {
+		e = r.fallback(result) // keep the error rather than hiding it by 406
+	}
+	if e == nil {
+		result, code = NewErrorMsg("not acceptable", accept, StatusNotAcceptable).WithReason(ReasonNotAcceptable), StatusNotAcceptable
+		if len(r.mediaTypes) == 0 {
+			w.WriteHeader(code)
+			return code, nil
+		}
+		e = r.encoders[r.mediaTypes[0]]
+	}
+
+	result = errorWithRequestId(c, result)
+
+	var buf bytes.Buffer
+	if err := e.Encode(&buf, result); err != nil {
+		w.WriteHeader(StatusInternalServerError)
+		return StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", e.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(code)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return code, err
+	}
+	return code, nil
+}
+
+// choose the encoder with highest q-value, nil if none is acceptable
+func (r *NegotiatingResponser) negotiate(accept string, result interface{}) Encoder {
+	ranges := parseAccept(accept)
+
+	var best Encoder
+	var bestQ float64
+
+	for _, mediaType := range r.mediaTypes {
+		e := r.encoders[mediaType]
+		if ec, ok := e.(encoderChecker); ok && !ec.CanEncode(result) {
+			continue
+		}
+
+		q := 1.0
+		if len(ranges) > 0 {
+			q = acceptQuality(ranges, mediaType)
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// the first encoder which can encode the result, nil if none
+func (r *NegotiatingResponser) fallback(result interface{}) Encoder {
+	for _, mediaType := range r.mediaTypes {
+		e := r.encoders[mediaType]
+		if ec, ok := e.(encoderChecker); !ok || ec.CanEncode(result) {
+			return e
+		}
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type acceptRange struct {
+	mediaType string // type/subtype, may be */* or type/*
+	q         float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		ar := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		if ar.mediaType == "" {
+			continue
+		}
+		if ar.mediaType == "*" {
+			ar.mediaType = "*/*"
+		}
+
+		for _, param := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(k)) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q >= 0 && q <= 1 {
+				ar.q = q
+			}
+		}
+		ranges = append(ranges, ar)
+	}
+
+	// the most specific range comes first
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return acceptSpecificity(ranges[i].mediaType) > acceptSpecificity(ranges[j].mediaType)
+	})
+	return ranges
+}
+
+func acceptSpecificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// q-value of the most specific range which matches the media type, 0 if none
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	for _, ar := range ranges {
+		if ar.mediaType == mediaType || ar.mediaType == "*/*" || ar.mediaType == typ+"/*" {
+			return ar.q
+		}
+	}
+	return 0
+}
+
+var _ Responser = (*NegotiatingResponser)(nil)
+var _ ContextResponser = (*NegotiatingResponser)(nil)
@@ -2,7 +2,6 @@ package web
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,22 +10,20 @@ import (
 	"net/http"
 	"net/textproto"
 	"net/url"
-	"strings"
 
 	"github.com/gorilla/mux"
 )
 
 func ParseParams(c *Context) error {
 	var err error
-	var k, v string
 
 	var r = c.Request
 
 	// parse params in url path
 	urlVars := mux.Vars(r)
 
-	for k, v = range urlVars {
-		c.Values[k] = v
+	for k, v := range urlVars {
+		c.setValues(k, []string{v}, LocationPath)
 	}
 
 	contentType, contentParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
@@ -39,39 +36,40 @@ func ParseParams(c *Context) error {
 	// It can't parse post body because r.Body is empty now
 	r.ParseForm()
 
-	for k, _ = range r.Form {
-		v = r.FormValue(k)
-		c.Values[k] = v
+	for k, vs := range r.Form {
+		c.setValues(k, vs, LocationQuery)
 	}
 
 	// parse params in body
 	if len(c.RawPostData) > 0 {
 
-		if strings.Contains(contentType, "application/json") {
-			var jsonValues = make(map[string]json.RawMessage) // just unpack the top layer of json struct
-
-			err = json.Unmarshal(c.RawPostData, &jsonValues)
+		decoders := c.decoders
+		if decoders == nil {
+			decoders = defaultDecoders
+		}
 
+		if decoder, ok := decoders[contentType]; ok {
+			vals, err := decoder.Decode(c.RawPostData, contentParams)
 			if err != nil {
-				return NewError(fmt.Sprintf("not json parameter: %s", err), http.StatusBadRequest)
+				if _, ok := err.(*Error); !ok {
+					err = NewErrorMsg("invalid body", err.Error(), http.StatusBadRequest)
+				}
+				return err
 			}
 
-			for k, raw := range jsonValues {
-				r.PostForm[k] = []string{string(raw)}
-
-				if len(raw) > 0 && (raw[0] != '"') {
-					c.Values[k] = string(raw) // not unpack json slice or object
+			for k, v := range vals {
+				if vs, ok := v.([]string); ok {
+					if len(vs) > 0 {
+						c.setValues(k, vs, LocationBody)
+						r.PostForm[k] = vs
+					}
 					continue
 				}
-				var v interface{}
-				err = json.Unmarshal(raw, &v)
-				if err != nil {
-					return NewError(fmt.Sprintf("not json parameter: %s", err), http.StatusBadRequest)
-				}
-				c.Values[k] = v
+				c.setValue(k, v, LocationBody)
+				r.PostForm[k] = []string{fmt.Sprint(v)}
 			}
 
-		} else if strings.Contains(contentType, "multipart/form-data") {
+		} else if contentType == "multipart/form-data" {
 			buf := bytes.NewBuffer(c.RawPostData)
 
 			mr := multipart.NewReader(buf, contentParams["boundary"])
@@ -101,37 +99,42 @@ func ParseParams(c *Context) error {
 				part.Data = d
 
 				if part.FileName == "" {
-					c.Values[part.FormName] = string(part.Data)
-					r.PostForm[part.FormName] = []string{string(part.Data)}
+					c.addValue(part.FormName, string(part.Data), LocationBody)
+					r.PostForm.Add(part.FormName, string(part.Data))
 				}
 
 				c.Multipart = append(c.Multipart, part)
 			}
 
-		} else if r.Method == "POST" ||
-			r.Method == "DELETE" ||
-			r.Method == "PUT" {
+		} else if r.Method != "POST" &&
+			r.Method != "DELETE" &&
+			r.Method != "PUT" &&
+			r.Method != "PATCH" {
+			// ignore body
+
+		} else if contentType == "application/x-www-form-urlencoded" || contentType == "" {
 
 			var vals url.Values
 			vals, err = url.ParseQuery(string(c.RawPostData))
 			if err != nil {
-				return fmt.Errorf("not querydict parameter")
+				return NewErrorMsg("not querydict parameter", err.Error(), http.StatusBadRequest)
 			}
 
 			for k, vs := range vals {
 				if len(vs) == 0 {
 					continue
-				} else if len(vs) == 1 {
-					c.Values[k] = vs[0]
-					r.PostForm[k] = vs
-				} else {
-					c.Values[k] = strings.Join(vs, ",")
-					r.PostForm[k] = vs
 				}
+				c.setValues(k, vs, LocationBody) // all values are kept for slice fields of Scheme
+				r.PostForm[k] = vs
 			}
 			c.Values["_POST_"] = vals
+
+		} else {
+			return NewErrorMsg("unsupported media type", contentType, StatusUnsupportedMediaType).WithReason(ReasonUnsupportedMediaType)
 		}
 	}
 
+	c.mergeValues()
+
 	return nil
 }
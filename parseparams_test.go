@@ -3,21 +3,25 @@ package web
 import (
 	"bytes"
 	"github.com/gorilla/mux"
+	"github.com/vmihailenco/msgpack/v5"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
-var context *Context
+var testContext *Context
 
 func serve(w http.ResponseWriter, r *http.Request) {
 
-	context, _ = newContext(w, r)
+	testContext, _ = newContext(w, r)
 
-	ParseParams(context)
+	ParseParams(testContext)
 }
 
 func checkparam(key string, val string, t *testing.T) {
-	vv, ok := context.Values[key]
+	vv, ok := testContext.Values[key]
 	if !ok {
 		t.Error("param '", key, "' not found")
 		return
@@ -81,11 +85,11 @@ And another
 	router.ServeHTTP(nil, req)
 
 	// check multipart
-	if len(context.Multipart) != 2 {
-		t.Fatal("context.Multipart len != 2", len(context.Multipart))
+	if len(testContext.Multipart) != 2 {
+		t.Fatal("testContext.Multipart len != 2", len(testContext.Multipart))
 	}
 
-	part := context.Multipart[0]
+	part := testContext.Multipart[0]
 	if part.FormName != "field1" {
 		t.Fatal("part.FormName != field1")
 	}
@@ -93,7 +97,7 @@ And another
 		t.Fatal("string(part.Data) != one A section")
 	}
 
-	part = context.Multipart[1]
+	part = testContext.Multipart[1]
 	if part.FormName != "userfile" {
 		t.Fatal("part.FormName != userfile")
 	}
@@ -104,10 +108,283 @@ And another
 		t.Fatal("string(part.Data) != And another")
 	}
 
-	if _, ok := context.Values["field1"]; !ok {
+	if _, ok := testContext.Values["field1"]; !ok {
 		t.Fatal("field1 not in Values")
 	}
-	if _, ok := context.Values["userfile"]; ok {
+	if _, ok := testContext.Values["userfile"]; ok {
 		t.Fatal("userfile should not be in Values")
 	}
 }
+
+func TestParseParamsLocations(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{id}", serve)
+
+	body := bytes.NewBuffer([]byte(`{"id":"body","q":"body"}`))
+	req, err := http.NewRequest("POST", "http://localhost/user/path?q=query&id=query", body)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Token", "token")
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "cookie"})
+
+	router.ServeHTTP(nil, req)
+
+	// merged by the default precedence, path wins, then body
+	checkparam("id", "path", t)
+	checkparam("q", "body", t)
+	if testContext.Sources["id"] != LocationPath {
+		t.Errorf("source of id = %v; want %v", testContext.Sources["id"], LocationPath)
+	}
+
+	args := struct {
+		Id     string `web:"id,path"`
+		Q      string `web:"q,query"`
+		Token  string `web:"token,header=X-Token"`
+		Sid    string `web:"sid,cookie,required"`
+		Absent string `web:"absent,header,none"`
+	}{}
+	if err := testContext.Scheme(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Id != "path" || args.Q != "query" || args.Token != "token" || args.Sid != "cookie" || args.Absent != "none" {
+		t.Errorf("args = %+v", args)
+	}
+
+	// missing cookie
+	missing := struct {
+		Other string `web:"other,cookie,required"`
+	}{}
+	err = testContext.Scheme(&missing)
+	if e, ok := err.(*Error); !ok || len(e.Details) != 1 || e.Details[0].Location != LocationCookie {
+		t.Errorf("err = %v; want a detail located in cookie", err)
+	}
+
+	// custom precedence
+	defer func(p []string) { ParamsPrecedence = p }(ParamsPrecedence)
+	ParamsPrecedence = []string{LocationQuery, LocationPath}
+
+	body = bytes.NewBuffer([]byte(`{"id":"body","b":"body"}`))
+	req, _ = http.NewRequest("POST", "http://localhost/user/path?id=query", body)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(nil, req)
+
+	checkparam("id", "query", t)
+	if _, ok := testContext.Values["b"]; ok {
+		t.Error("body should not be merged")
+	}
+	if v, _ := testContext.Param(LocationBody, "b"); v != "body" {
+		t.Errorf("body param b = %v; want body", v)
+	}
+}
+
+func TestParamsPrecedenceOfWeb(t *testing.T) {
+	handle := func(w *Web) {
+		w.SetLogger(nil)
+		w.Handle("POST", "/users/{id}", func(c *Context) interface{} {
+			return c.Values["id"]
+		})
+	}
+	a, b := NewWeb(), NewWeb()
+	b.SetParamsPrecedence(LocationBody, LocationPath)
+	handle(a)
+	handle(b)
+
+	for w, want := range map[*Web]string{a: "path", b: "body"} {
+		r := httptest.NewRequest("POST", "/users/path?id=query", strings.NewReader(`{"id":"body"}`))
+		r.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, r)
+		if rec.Body.String() != want {
+			t.Errorf("id = %s; want %s", rec.Body, want)
+		}
+	}
+}
+
+func TestRegisterDecoderAfterHandle(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	handler := func(c *Context) interface{} {
+		return c.Values["name"]
+	}
+	w.Handle("POST", "/before", handler)
+	w.RegisterDecoder("text/csv", new(testCSVDecoder))
+	w.Handle("POST", "/after", handler)
+
+	for path, code := range map[string]int{"/before": StatusUnsupportedMediaType, "/after": StatusOK} {
+		r := httptest.NewRequest("POST", path, strings.NewReader("name:jerry"))
+		r.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, r)
+		if rec.Code != code {
+			t.Errorf("%s: code = %d; want %d", path, rec.Code, code)
+		}
+	}
+}
+
+func TestParamsBodyOverQuery(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Handle("POST", "/p", func(c *Context) interface{} {
+		return c.Values["name"]
+	})
+
+	r := httptest.NewRequest("POST", "/p?name=query", strings.NewReader("name=body"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if rec.Body.String() != "body" {
+		t.Errorf("name = %s; want body", rec.Body)
+	}
+}
+
+func TestParseParamsSlices(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/slices", serve)
+
+	body := bytes.NewBuffer([]byte("tag=a%2Cb&tag=c&num[]=1&num[]=2&idx[1]=y&idx[0]=x&idx[10]=z"))
+	req, err := http.NewRequest("POST", "http://localhost/slices?q=1&q=2&csv=1,2&csv=3&one=5&single=a,b&arr=[1,2]", body)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	router.ServeHTTP(nil, req)
+
+	// the first one for non-slice fields, no more joined by comma
+	checkparam("tag", "a,b", t)
+	checkparam("q", "1", t)
+
+	args := struct {
+		Tag []string `web:"tag"`
+		Q   []int    `web:"q,query"`
+		Csv []int    `web:"csv,comma"`
+		Num []int64  `web:"num,brackets"`
+		Idx []string `web:"idx,indexed"`
+		One []int    `web:"one"`
+		Nil []int    `web:"nil,brackets"`
+
+		Single []string `web:"single"`
+		Arr    []int    `web:"arr"`
+	}{}
+	if err := testContext.Scheme(&args); err != nil {
+		t.Fatal(err)
+	}
+
+	chk := args
+	chk.Tag = []string{"a,b", "c"}
+	chk.Q = []int{1, 2}
+	chk.Csv = []int{1, 2, 3}
+	chk.Num = []int64{1, 2}
+	chk.Idx = []string{"x", "y", "z"}
+	chk.One = []int{5}
+	chk.Nil = nil
+	chk.Single = []string{"a,b"}
+	chk.Arr = []int{1, 2}
+
+	if !reflect.DeepEqual(args, chk) {
+		t.Errorf("args = %+v; want %+v", args, chk)
+	}
+
+	// invalid element
+	bad := struct {
+		Tag []int `web:"tag"`
+	}{}
+	err = testContext.Scheme(&bad)
+	if e, ok := err.(*Error); !ok || len(e.Details) != 1 || e.Details[0].Location != LocationBody {
+		t.Errorf("err = %v; want a detail located in body", err)
+	}
+}
+
+type testCSVDecoder struct{}
+
+func (d *testCSVDecoder) Decode(body []byte, params map[string]string) (map[string]interface{}, error) {
+	vals := make(map[string]interface{})
+	for _, kv := range strings.Split(string(body), ";") {
+		if i := strings.Index(kv, ":"); i > 0 {
+			vals[kv[:i]] = kv[i+1:]
+		}
+	}
+	return vals, nil
+}
+
+func TestParseParamsDecoders(t *testing.T) {
+	parse := func(contentType string, body []byte, decoders map[string]Decoder) (*Context, error) {
+		req, _ := http.NewRequest("POST", "http://localhost/decode", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", contentType)
+		c, _ := newContext(nil, req)
+		c.decoders = decoders
+		return c, ParseParams(c)
+	}
+
+	// xml
+	c, err := parse("application/xml; charset=utf-8", []byte(`<msg><id>1</id><tag>a</tag><tag>b</tag><item><name>x</name></item></msg>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testContext = c
+	checkparam("id", "1", t)
+	checkparam("item", "<name>x</name>", t)
+	if vs := c.ParamValues(LocationBody, "tag"); !reflect.DeepEqual(vs, []string{"a", "b"}) {
+		t.Errorf("tag = %v; want [a b]", vs)
+	}
+
+	// CDATA is text, not nested xml
+	c, err = parse("application/xml", []byte(`<msg><expr><![CDATA[a < b]]></expr></msg>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testContext = c
+	checkparam("expr", "a < b", t)
+
+	// msgpack
+	data, _ := msgpack.Marshal(map[string]interface{}{"id": 2, "name": "tom", "list": []int{1, 2}})
+	c, err = parse("application/msgpack", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := struct {
+		Id   int    `web:"id"`
+		Name string `web:"name"`
+		List []int  `web:"list"`
+	}{}
+	if err = c.Scheme(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Id != 2 || args.Name != "tom" || !reflect.DeepEqual(args.List, []int{1, 2}) {
+		t.Errorf("args = %+v", args)
+	}
+
+	// unknown media type
+	_, err = parse("text/csv", []byte("id:3"), nil)
+	if e, ok := err.(*Error); !ok || e.Code != StatusUnsupportedMediaType {
+		t.Errorf("err = %v; want 415", err)
+	}
+
+	// registered decoder
+	c, err = parse("text/csv", []byte("id:3;name:jerry"), map[string]Decoder{"text/csv": new(testCSVDecoder)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testContext = c
+	checkparam("id", "3", t)
+	checkparam("name", "jerry", t)
+
+	// PATCH has a body as POST and PUT
+	req, _ := http.NewRequest("PATCH", "http://localhost/decode", bytes.NewBufferString("name=spike"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c, _ = newContext(nil, req)
+	if err = ParseParams(c); err != nil {
+		t.Fatal(err)
+	}
+	testContext = c
+	checkparam("name", "spike", t)
+
+	req, _ = http.NewRequest("PATCH", "http://localhost/decode", bytes.NewBufferString("id:3"))
+	req.Header.Set("Content-Type", "text/csv")
+	c, _ = newContext(nil, req)
+	if e, ok := ParseParams(c).(*Error); !ok || e.Code != StatusUnsupportedMediaType {
+		t.Errorf("PATCH err = %v; want 415", e)
+	}
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const MediaTypeProblem = "application/problem+json"
+
+// ProblemResponser responses errors as problem details of RFC 7807:
+//
+//	{"type":"https://example.com/probs/not_found","title":"not found","status":404,
+//	 "detail":"user 12 not found","instance":"/users/12","request_id":"0192b3c4-5d6e-7f80-9a1b-2c3d4e5f6a7b","reason":"not_found"}
+//
+// An error is converted by ToError, so that registered errors have their own status codes.
+// Field errors are in the errors member. Other results are written by the inner Responser,
+// DefaultResponser if nil. To use it:
+//
+//	w.SetResponser(web.NewProblemResponser(nil))
+//
+// If ByAccept is true, problem details are only responsed to clients which accept
+// application/problem+json explicitly, others get the shape of the inner Responser.
+type ProblemResponser struct {
+	ByAccept bool
+
+	// Type of a problem is TypeBase followed by the reason of the error, such as
+	// "https://example.com/probs/". It's "about:blank" if either is empty.
+	TypeBase string
+
+	inner Responser
+}
+
+// Problem is the problem details of RFC 7807 with extension members.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	RequestId string       `json:"request_id,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Cause     string       `json:"cause,omitempty"` // only in debug mode
+}
+
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
+
+func NewProblemResponser(inner Responser) *ProblemResponser {
+	if inner == nil {
+		inner = new(DefaultResponser)
+	}
+	r := new(ProblemResponser)
+	r.inner = inner
+	return r
+}
+
+func (r *ProblemResponser) Response(w http.ResponseWriter, result interface{}) (int, error) {
+	return r.response(nil, w, result)
+}
+
+func (r *ProblemResponser) ResponseContext(c *Context, result interface{}) (int, error) {
+	return r.response(c, c.ResponseWriter, result)
+}
+
+func (r *ProblemResponser) response(c *Context, w http.ResponseWriter, result interface{}) (int, error) {
+	err, ok := result.(error)
+	if !ok {
+		return response(r.inner, c, w, result)
+	}
+	if r.ByAccept {
+		w.Header().Add("Vary", "Accept")
+		if !acceptsProblem(c) {
+			return response(r.inner, c, w, result)
+		}
+	}
+
+	setHeaders(w, result)
+	p := r.Problem(c, err)
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(StatusInternalServerError)
+		return StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", MediaTypeProblem)
+	w.WriteHeader(p.Status)
+	if _, err = w.Write(data); err != nil {
+		return p.Status, err
+	}
+	return p.Status, nil
+}
+
+// Convert an error into a Problem. The context can be nil.
+func (r *ProblemResponser) Problem(c *Context, err error) *Problem {
+	e := publicError(err)
+
+	p := new(Problem)
+	p.Type = "about:blank"
+	if r.TypeBase != "" && e.Reason != "" {
+		p.Type = r.TypeBase + e.Reason
+	}
+	p.Title = e.Err
+	if p.Title == "" {
+		p.Title = http.StatusText(e.Code)
+	}
+	p.Status = e.Code
+	p.Detail = e.Message
+	p.Reason = e.Reason
+	p.Errors = e.Details
+	p.Cause = e.Cause
+
+	if c != nil {
+		p.Instance = c.Request.URL.Path
+		p.RequestId = c.RequestId
+	}
+	return p
+}
+
+// the client accepts problem details explicitly, not by wildcards
+func acceptsProblem(c *Context) bool {
+	if c == nil {
+		return false
+	}
+	for _, ar := range parseAccept(c.Request.Header.Get("Accept")) {
+		if ar.mediaType == MediaTypeProblem && ar.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var _ Responser = (*ProblemResponser)(nil)
+var _ ContextResponser = (*ProblemResponser)(nil)
+var _ StatusCode = (*Problem)(nil)
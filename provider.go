@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// provider gives values of a type for the args of handlers, either a singleton or created
+// by a factory for each request.
+type provider struct {
+	value   reflect.Value // the singleton, invalid if it's a factory
+	factory reflect.Value // func(*Context) T or func(*Context) (T, error)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf(new(Context))
+
+// Register a singleton to be injected into handlers which declare an arg of its type, such
+// as a database:
+//
+//	w.Provide(db) // *sql.DB
+//	w.Handle("GET", "/users/{id}", func(c *web.Context, args GetUserArgs, db *sql.DB) interface{} {
+//		...
+//	})
+//
+// Like SetResponser, it only affects handlers registered after it. Handle panics if an arg
+// has no provider. To provide an interface type, use ProvideFunc returning the interface.
+func (w *Web) Provide(v interface{}) {
+	if v == nil {
+		panic("provide nil")
+	}
+	w.addProvider(reflect.TypeOf(v), &provider{value: reflect.ValueOf(v)})
+}
+
+// Register a factory to create a value for each request, which is called before the
+// handler. The factory is func(*Context) T, or func(*Context) (T, error) which responses
+// the error instead of calling the handler, such as to load the current user:
+//
+//	w.ProvideFunc(func(c *web.Context) (*User, error) {
+//		return users.Get(c, c.Request.Header.Get("X-User"))
+//	})
+func (w *Web) ProvideFunc(fn interface{}) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0) != contextType ||
+		t.NumOut() < 1 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		panic(fmt.Sprintf("provider must be func(*Context) T or func(*Context) (T, error), %v", t))
+	}
+	w.addProvider(t.Out(0), &provider{factory: reflect.ValueOf(fn)})
+}
+
+func (w *Web) addProvider(t reflect.Type, p *provider) {
+	if t == contextType {
+		panic("can't provide *Context")
+	}
+	if _, ok := w.providers[t]; ok {
+		panic("provider conflict: " + t.String())
+	}
+	w.providers[t] = p
+}
+
+// get the value for a request, or an error from the factory
+func (p *provider) provide(c *Context) (reflect.Value, error) {
+	if p.value.IsValid() {
+		return p.value, nil
+	}
+	outs := p.factory.Call([]reflect.Value{reflect.ValueOf(c)})
+	if len(outs) == 2 && !outs[1].IsNil() {
+		return reflect.Value{}, outs[1].Interface().(error)
+	}
+	return outs[0], nil
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testDB struct {
+	Name string
+}
+
+type testStore interface {
+	Get(id string) string
+}
+
+func (db *testDB) Get(id string) string {
+	return db.Name + ":" + id
+}
+
+func TestProvide(t *testing.T) {
+	var created int
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Provide(&testDB{Name: "db"})
+	w.ProvideFunc(func(c *Context) testStore {
+		return &testDB{Name: "store"}
+	})
+	w.ProvideFunc(func(c *Context) (*testUser, error) {
+		created++
+		name := c.Request.Header.Get("X-User")
+		if name == "" {
+			return nil, NewError("unauthorized", StatusUnauthorized)
+		}
+		return &testUser{Name: name}, nil
+	})
+
+	w.Handle("GET", "/users/{id}", func(c *Context, args struct {
+		Id string `web:"id"`
+	}, db *testDB, store testStore, user *testUser) interface{} {
+		return user.Name + " " + db.Get(args.Id) + " " + store.Get(args.Id)
+	})
+	w.Handle("GET", "/db", func(c *Context, db *testDB) interface{} {
+		return db.Name
+	})
+
+	for _, tt := range []struct {
+		Path string
+		User string
+		Code int
+		Body string
+	}{
+		{"/users/1", "gopher", StatusOK, "gopher db:1 store:1"},
+		{"/users/1", "", StatusUnauthorized, `"error":"unauthorized"`},
+		{"/db", "", StatusOK, "db"},
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.Path, nil)
+		r.Header.Set("X-User", tt.User)
+		w.ServeHTTP(rec, r)
+		if rec.Code != tt.Code || !strings.Contains(rec.Body.String(), tt.Body) {
+			t.Errorf("%s: code = %d, body = %s; want %d %s", tt.Path, rec.Code, rec.Body, tt.Code, tt.Body)
+		}
+	}
+	if created != 2 {
+		t.Errorf("factory called %d times; want 2", created)
+	}
+}
+
+func TestProvidePanics(t *testing.T) {
+	mustPanic := func(name string, want string, fn func()) {
+		defer func() {
+			e := recover()
+			if e == nil || !strings.Contains(e.(string), want) {
+				t.Errorf("%s: panic = %v; want %q", name, e, want)
+			}
+		}()
+		fn()
+	}
+
+	w := NewWeb()
+	w.Provide(&testDB{})
+
+	mustPanic("missing", "No provider of arg *web.testUser", func() {
+		w.Handle("GET", "/missing", func(c *Context, db *testDB, user *testUser) interface{} { return nil })
+	})
+	mustPanic("not struct", "The arg must be a struct", func() {
+		w.Handle("GET", "/int", func(c *Context, id int) interface{} { return nil })
+	})
+	mustPanic("conflict", "provider conflict: *web.testDB", func() {
+		w.Provide(&testDB{})
+	})
+	mustPanic("factory", "provider must be", func() {
+		w.ProvideFunc(func(c *Context) (*testUser, string) { return nil, "" })
+	})
+	mustPanic("factory error", "provider must be", func() {
+		w.ProvideFunc(func() error { return errors.New("x") })
+	})
+
+	// registered before Handle
+	w.ProvideFunc(func(c *Context) *testUser { return nil })
+	w.Handle("GET", "/user", func(c *Context, user *testUser) interface{} { return nil })
+}
@@ -0,0 +1,299 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Replacement of redacted values in logs.
+const Redacted = "[REDACTED]"
+
+// The redaction policy applied by built-in loggers. Params and fields of results matching
+// Keys or Patterns are redacted, so are headers in Headers. Params of a scheme field with
+// the secret option are redacted too:
+//
+//	Password string `web:"password,secret"`
+var Redaction = NewRedactPolicy()
+
+// RedactPolicy tells what to hide in logs.
+type RedactPolicy struct {
+	Keys      []string         // keys of params and fields, case-insensitive
+	Patterns  []*regexp.Regexp // keys matching any of them
+	Headers   []string         // names of headers
+	MaxLength int              // max length of logged results, no limit if 0
+}
+
+// Create a policy with default rules, to redact keys like password and token, headers
+// of credentials, and to cap results at 1024 bytes.
+func NewRedactPolicy() *RedactPolicy {
+	p := new(RedactPolicy)
+	p.Patterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)passw|secret|token|api_?key|credential|private_?key`),
+	}
+	p.Headers = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	p.MaxLength = 1024
+	return p
+}
+
+// Check if the value of the key should be redacted.
+func (p *RedactPolicy) IsSecret(key string) bool {
+	for _, k := range p.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	for _, re := range p.Patterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get a copy of the header with values of secret headers redacted, which are in Headers
+// or match Keys and Patterns.
+func (p *RedactPolicy) Header(h http.Header) http.Header {
+	r := h.Clone()
+	for name := range r {
+		if p.isSecretHeader(name) {
+			r[name] = []string{Redacted}
+		}
+	}
+	return r
+}
+
+func (p *RedactPolicy) isSecretHeader(name string) bool {
+	for _, n := range p.Headers {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return p.IsSecret(name)
+}
+
+// Format params as "k1=v1&k2=v2" sorted by keys, with secret values redacted, also secret
+// keys of a nested json object, such as user={"name":"a","password":"[REDACTED]"}.
+func (p *RedactPolicy) Params(params map[string]interface{}) string {
+	return p.params(params, nil)
+}
+
+// Get the request URI with values of secret query params redacted, such as
+// "/q?access_token=[REDACTED]&page=2".
+func (p *RedactPolicy) RequestURI(r *http.Request) string {
+	return p.requestURI(r, nil)
+}
+
+// Format a result for logging, with secret keys of maps or fields of structs redacted, also
+// in slices and nested values, and truncated to MaxLength.
+func (p *RedactPolicy) Result(result interface{}) string {
+	var s string
+	switch v := result.(type) {
+	case nil:
+		s = "<nil>"
+	case *Payload: // before Stringer, which prints the body as is
+		s = p.payload(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	case []byte:
+		s = fmt.Sprintf("[%d bytes]", len(v))
+	default:
+		s = fmt.Sprintf("%v", p.redactValue(reflect.ValueOf(result), 0))
+	}
+	return p.truncate(s)
+}
+
+func (p *RedactPolicy) payload(r *Payload) string {
+	if r == nil || r.Body == nil {
+		return fmt.Sprint(r)
+	}
+	return fmt.Sprintf("%d %s %v", r.Code, http.StatusText(r.Code), p.redactValue(reflect.ValueOf(r.Body), 0))
+}
+
+func (p *RedactPolicy) params(params map[string]interface{}, secrets map[string]bool) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		if b.Len() > 0 {
+			b.WriteString("&")
+		}
+		v := fmt.Sprint(params[k])
+		if secrets[strings.ToLower(k)] || p.IsSecret(k) {
+			v = Redacted
+		} else if s, ok := p.redactJSON(v); ok {
+			v = s // a nested object of a json body, such as {"user":{"password":"..."}}
+		}
+		fmt.Fprintf(&b, "%s=%s", k, v)
+	}
+	return p.truncate(strings.Replace(b.String(), "\n", " ", -1))
+}
+
+func (p *RedactPolicy) requestURI(r *http.Request, secrets map[string]bool) string {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || query == "" {
+		return uri
+	}
+
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		rawKey, _, _ := strings.Cut(part, "=")
+		k, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			k = rawKey
+		}
+		if secrets[strings.ToLower(k)] || p.IsSecret(k) {
+			parts[i] = rawKey + "=" + Redacted
+		}
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// redact secret keys of a json object or array, false if it's not one
+func (p *RedactPolicy) redactJSON(s string) (string, bool) {
+	if !strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[") {
+		return "", false
+	}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", false
+	}
+	data, err := json.Marshal(p.redactJSONValue(v))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (p *RedactPolicy) redactJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if p.IsSecret(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = p.redactJSONValue(x)
+			}
+		}
+	case []interface{}:
+		for i, x := range v {
+			v[i] = p.redactJSONValue(x)
+		}
+	}
+	return v
+}
+
+// max depth of nested values to redact, deeper ones are not formatted
+const maxRedactDepth = 8
+
+// redact keys of maps and fields of structs, recursively into slices and nested values
+func (p *RedactPolicy) redactValue(v reflect.Value, depth int) interface{} {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if depth > maxRedactDepth {
+		return "..."
+	}
+	if v.IsValid() && v.Kind() != reflect.Ptr && v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case error:
+			return x.Error()
+		case fmt.Stringer:
+			return x.String() // such as time.Time
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = p.redactValue(v.Index(i), depth+1)
+		}
+		return items
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			if p.IsSecret(k) {
+				m[k] = Redacted
+			} else {
+				m[k] = p.redactValue(iter.Value(), depth+1)
+			}
+		}
+		return m
+
+	case reflect.Struct:
+		t := v.Type()
+		var b strings.Builder
+		b.WriteString("{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if b.Len() > 1 {
+				b.WriteString(" ")
+			}
+			if p.secretField(f) {
+				fmt.Fprintf(&b, "%s:%s", f.Name, Redacted)
+			} else {
+				fmt.Fprintf(&b, "%s:%v", f.Name, p.redactValue(v.Field(i), depth+1))
+			}
+		}
+		b.WriteString("}")
+		return b.String()
+	}
+
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (p *RedactPolicy) truncate(s string) string {
+	if p.MaxLength > 0 && len(s) > p.MaxLength {
+		return fmt.Sprintf("%s...(%d bytes)", s[:p.MaxLength], len(s))
+	}
+	return s
+}
+
+// the field is tagged with the secret option of Scheme, or its name or the name in the json
+// or scheme tag is secret, such as Pwd `json:"password"`
+func (p *RedactPolicy) secretField(f reflect.StructField) bool {
+	if p.IsSecret(f.Name) {
+		return true
+	}
+	if tag, ok := f.Tag.Lookup(SchemeTagName); ok {
+		st := parseSchemeTag(tag)
+		if st.secret || (st.name != "" && p.IsSecret(st.name)) {
+			return true
+		}
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name != "" && name != "-" && p.IsSecret(name)
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+var (
+	// Header of request ids. An inbound id is accepted if it's valid, and the id is echoed in
+	// the response header. Ids are neither accepted nor echoed if it's empty.
+	RequestIdHeader = "X-Request-Id"
+
+	// Generate an id for a request without a valid inbound one, such as NewUUIDv7 or NewULID.
+	NewRequestId = NewUUIDv7
+
+	// Validate an inbound request id. By default it must be 1 to 128 characters of letters,
+	// digits and "-_.:", so that it's safe to log and to pass downstream.
+	ValidRequestId = validRequestId
+)
+
+type requestIdKey struct{}
+
+// Get the request id from the context of a request, such as c.Request.Context(), for
+// downstream code which doesn't know the Context. Empty if not found.
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// Get the request id from the inbound header or generate one, then echo it.
+func requestId(c *Context) string {
+	var id string
+	if RequestIdHeader != "" {
+		id = c.Request.Header.Get(RequestIdHeader)
+	}
+	if id == "" || !ValidRequestId(id) {
+		id = NewRequestId()
+	}
+	if RequestIdHeader != "" && c.ResponseHeader != nil {
+		c.ResponseHeader.Set(RequestIdHeader, id)
+	}
+	return id
+}
+
+// Copy an *Error with the request id, so that clients can report it. Others are returned as is.
+func errorWithRequestId(c *Context, result interface{}) interface{} {
+	e, ok := result.(*Error)
+	if !ok || c == nil || c.RequestId == "" || e.RequestId != "" {
+		return result
+	}
+	d := *e
+	d.RequestId = c.RequestId
+	return &d
+}
+
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, ch := range id {
+		switch {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		case ch == '-' || ch == '_' || ch == '.' || ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Generate a UUID version 7, which is ordered by time, see RFC 9562.
+func NewUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	putMillis(b[:6], time.Now())
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generate a ULID, which is ordered by time, 26 characters in Crockford's base32.
+func NewULID() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	putMillis(b[:6], time.Now())
+
+	// 128 bits into 26 characters of 5 bits, the first one has only 3 bits
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// put the unix time in milliseconds as 48-bit big endian
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
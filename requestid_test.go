@@ -0,0 +1,93 @@
+package web
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestId(t *testing.T) {
+	var got string
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Handle("GET", "/id", func(c *Context) interface{} {
+		got = RequestIdFromContext(c.Request.Context())
+		if got != c.RequestId {
+			t.Errorf("RequestIdFromContext = %q; want %q", got, c.RequestId)
+		}
+		return "ok"
+	})
+	w.Handle("GET", "/fail", func(c *Context) interface{} {
+		return NewError("not found", StatusNotFound)
+	})
+
+	// accepted and echoed
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/id", nil)
+	r.Header.Set("X-Request-Id", "abc-123")
+	w.ServeHTTP(rec, r)
+	if got != "abc-123" || rec.Header().Get("X-Request-Id") != "abc-123" {
+		t.Errorf("inbound: got %q, header %q", got, rec.Header().Get("X-Request-Id"))
+	}
+
+	// invalid ids are replaced
+	for _, id := range []string{"bad id", "a\nb", strings.Repeat("x", 129)} {
+		rec = httptest.NewRecorder()
+		r = httptest.NewRequest("GET", "/id", nil)
+		r.Header.Set("X-Request-Id", id)
+		w.ServeHTTP(rec, r)
+		if got == id || len(got) != 36 || rec.Header().Get("X-Request-Id") != got {
+			t.Errorf("invalid %q: got %q", id, got)
+		}
+	}
+
+	// in error bodies
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/fail", nil)
+	r.Header.Set("X-Request-Id", "abc-123")
+	w.ServeHTTP(rec, r)
+	if body := rec.Body.String(); body != `{"error":"not found","request_id":"abc-123"}` {
+		t.Errorf("error body = %s", body)
+	}
+
+	// disabled header
+	defer func(h string) { RequestIdHeader = h }(RequestIdHeader)
+	RequestIdHeader = ""
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/id", nil)
+	r.Header.Set("X-Request-Id", "abc-123")
+	w.ServeHTTP(rec, r)
+	if got == "abc-123" || got == "" || rec.Header().Get("X-Request-Id") != "" {
+		t.Errorf("disabled: got %q, header %q", got, rec.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestNewRequestId(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		u, l := NewUUIDv7(), NewULID()
+		if !uuid.MatchString(u) {
+			t.Errorf("NewUUIDv7 = %s", u)
+		}
+		if !ulid.MatchString(l) {
+			t.Errorf("NewULID = %s", l)
+		}
+		if seen[u] || seen[l] {
+			t.Errorf("duplicated %s %s", u, l)
+		}
+		seen[u], seen[l] = true, true
+	}
+
+	// ordered by time
+	u, l := NewUUIDv7(), NewULID()
+	time.Sleep(2 * time.Millisecond)
+	if u2, l2 := NewUUIDv7(), NewULID(); u2 <= u || l2 <= l {
+		t.Errorf("not ordered: %s %s, %s %s", u, u2, l, l2)
+	}
+}
@@ -9,53 +9,153 @@ type StatusCode interface {
 	StatusCode() int
 }
 
+// Writeable is a result which writes the response by itself. Headers of the result are set
+// before OnWrite, but the status code is not written, OnWrite should call WriteHeader if needed.
 type Writeable interface {
 	OnWrite(w http.ResponseWriter) error
 }
 
+// ContextWriteable is a Writeable which needs the request, such as a file served with Range
+// requests. OnWriteContext is called instead of OnWrite if the Responser knows the context.
+type ContextWriteable interface {
+	Writeable
+	OnWriteContext(c *Context) error
+}
+
+// Headers is implemented by a result which needs to set response headers.
+type Headers interface {
+	Headers() http.Header
+}
+
+// Set headers of the result into response headers. It must be called before WriteHeader.
+func setHeaders(w http.ResponseWriter, result interface{}) {
+	hs, ok := result.(Headers)
+	if !ok {
+		return
+	}
+	header := w.Header()
+	for k, vs := range hs.Headers() {
+		header[k] = vs
+	}
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 type Responser interface {
 	Response(w http.ResponseWriter, result interface{}) (code int, err error)
 }
 
-///////////////////////////////////////////////////////////////////////////////
+// ContextResponser is a Responser which needs the request, for example to negotiate the
+// format by Accept header. If a Responser implements it, ResponseContext is called instead
+// of Response, and the result is written into c.ResponseWriter.
+type ContextResponser interface {
+	ResponseContext(c *Context, result interface{}) (code int, err error)
+}
 
-type DefaultResponser struct {
+func response(r Responser, c *Context, w http.ResponseWriter, result interface{}) (int, error) {
+	if cr, ok := r.(ContextResponser); ok && c != nil {
+		return cr.ResponseContext(c, result)
+	}
+	return r.Response(w, result)
 }
 
-func (r *DefaultResponser) Response(w http.ResponseWriter, result interface{}) (int, error) {
-	if result == nil {
-		return StatusOK, nil
+// Convert an error to *Error by ToError, get the status code of result, and unwrap the body
+// of a *Payload.
+func statusResult(result interface{}) (interface{}, int) {
+	if err, ok := result.(error); ok {
+		result = publicError(err)
+	}
+
+	var code int = StatusOK
+	if sc, ok := result.(StatusCode); ok {
+		code = sc.StatusCode()
+	}
+
+	if p, ok := result.(*Payload); ok {
+		result = p.Body
 	}
-	var err error
+	return result, code
+}
 
+// Write nil, []byte, string and Writeable results directly. It returns false for other
+// results, which should be encoded. The context can be nil. The returned code is the one
+// actually written by a Writeable, such as 206 or 304 of a file.
+func writeDirect(c *Context, w http.ResponseWriter, code int, result interface{}) (bool, int, error) {
 	switch v := result.(type) {
+	case nil:
+		if code != StatusOK {
+			w.WriteHeader(code)
+		}
+		return true, code, nil
+
 	case []byte:
+		if code != StatusOK {
+			w.WriteHeader(code)
+		}
 		_, err := w.Write(v)
-		return StatusOK, err
+		return true, code, err
 
 	case string:
+		if code != StatusOK {
+			w.WriteHeader(code)
+		}
 		_, err := w.Write([]byte(v))
-		return StatusOK, err
+		return true, code, err
 
-	case error: // unknown error
-		if _, ok := v.(*Error); ok {
-			break
+	case ContextWriteable:
+		var err error
+		if c != nil {
+			err = v.OnWriteContext(c)
+		} else {
+			err = v.OnWrite(w)
 		}
-		result = NewErrorMsg("server error", v.Error(), StatusInternalServerError)
+		return true, writtenCode(c, code, err), err
+
+	case Writeable:
+		err := v.OnWrite(w)
+		return true, writtenCode(c, code, err), err
+	}
+	return false, code, nil
+}
+
+// Get the status code sent by a Writeable, or of the error it returns if unknown.
+func writtenCode(c *Context, code int, err error) int {
+	if c != nil {
+		if st := c.ResponseState(); st.HeaderSent {
+			return st.Status
+		}
+	}
+	if sc, ok := err.(StatusCode); ok {
+		return sc.StatusCode()
 	}
+	return code
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type DefaultResponser struct {
+}
+
+func (r *DefaultResponser) Response(w http.ResponseWriter, result interface{}) (int, error) {
+	return r.response(nil, w, result)
+}
+
+func (r *DefaultResponser) ResponseContext(c *Context, result interface{}) (int, error) {
+	return r.response(c, c.ResponseWriter, result)
+}
+
+func (r *DefaultResponser) response(c *Context, w http.ResponseWriter, result interface{}) (int, error) {
+	setHeaders(w, result)
 
 	// get status code
-	var code int = StatusOK
-	sc, ok := result.(StatusCode)
-	if ok {
-		code = sc.StatusCode()
+	result, code := statusResult(result)
+
+	if ok, code, err := writeDirect(c, w, code, result); ok {
+		return code, err
 	}
-	w.WriteHeader(code)
 
 	// write data
-	err = r.writeResult(w, result)
+	err := r.writeResult(w, code, errorWithRequestId(c, result))
 	if err != nil {
 		return StatusInternalServerError, err
 	}
@@ -63,14 +163,19 @@ func (r *DefaultResponser) Response(w http.ResponseWriter, result interface{}) (
 	return code, nil
 }
 
-func (r *DefaultResponser) writeResult(w http.ResponseWriter, result interface{}) error {
+func (r *DefaultResponser) writeResult(w http.ResponseWriter, code int, result interface{}) error {
 	data, err := json.Marshal(result)
 	if err != nil {
+		w.WriteHeader(StatusInternalServerError)
 		return err
 	}
 	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(code)
 	if _, err = w.Write(data); err != nil {
 		return err
 	}
 	return nil
 }
+
+var _ Responser = (*DefaultResponser)(nil)
+var _ ContextResponser = (*DefaultResponser)(nil)
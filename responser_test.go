@@ -1,11 +1,18 @@
 package web
 
 import (
+	"encoding/xml"
 	"errors"
 	// "fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 func TestResponser(t *testing.T) {
@@ -22,7 +29,7 @@ func TestResponser(t *testing.T) {
 		{nil, "", http.StatusOK},
 		{"test1", "test1", http.StatusOK},
 		{[]byte("test2"), "test2", http.StatusOK},
-		{errors.New("test3"), `{"error":"server error","message":"test3"}`, http.StatusInternalServerError},
+		{errors.New("test3"), `{"error":"server error","reason":"internal"}`, http.StatusInternalServerError},
 		{T{"a", "b"}, `{"A":"a","B":"b"}`, http.StatusOK},
 	}
 
@@ -44,3 +51,306 @@ func TestResponser(t *testing.T) {
 		}
 	}
 }
+
+func TestResponserFieldErrors(t *testing.T) {
+	responser := new(DefaultResponser)
+	w := httptest.NewRecorder()
+
+	e := NewErrorMsg("invalid argument", "'id' is required", StatusBadRequest)
+	e.AddDetail("id", LocationQuery, FieldRequired, "'id' is required")
+
+	code, _ := responser.Response(w, e)
+	if code != StatusBadRequest {
+		t.Errorf("code = %v; want %v", code, StatusBadRequest)
+	}
+	want := `{"error":"invalid argument","message":"'id' is required","details":[{"field":"id","location":"query","code":"required","message":"'id' is required"}]}`
+	if w.Body.String() != want {
+		t.Errorf("body = %v; want %v", w.Body, want)
+	}
+}
+
+func TestNegotiatingResponser(t *testing.T) {
+	type Row struct {
+		Id   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	rows := []Row{{1, "a"}, {2, "b,c"}}
+
+	testCases := []struct {
+		Accept      string
+		Result      interface{}
+		Code        int
+		ContentType string
+		Body        string
+	}{
+		{"", Result{"id": 1}, http.StatusOK, "application/json;charset=utf-8", `{"id":1}`},
+		{"*/*", rows[0], http.StatusOK, "application/json;charset=utf-8", `{"id":1,"name":"a"}`},
+		{"text/html, application/xml;q=0.9, */*;q=0.1", Result{"id": 1, "tags": []string{"x", "y"}}, http.StatusOK,
+			"application/xml;charset=utf-8", xml.Header + `<result><id>1</id><tags><item>x</item><item>y</item></tags></result>`},
+		{"text/csv", rows, http.StatusOK, "text/csv;charset=utf-8", "id,name\n1,a\n2,\"b,c\"\n"},
+		{"text/csv, application/json;q=0.5", rows[0], http.StatusOK, "application/json;charset=utf-8", `{"id":1,"name":"a"}`},
+		{"application/*;q=0.2, application/yaml", Result{"id": 1}, http.StatusOK, "application/yaml;charset=utf-8", "id: 1\n"},
+		{"*/*;q=0.5, application/json;q=0", Result{"id": 1}, http.StatusOK, "application/xml;charset=utf-8", xml.Header + `<result><id>1</id></result>`},
+		{"text/html", Result{"id": 1}, http.StatusNotAcceptable, "application/json;charset=utf-8", `{"error":"not acceptable","reason":"not_acceptable","message":"text/html"}`},
+		{"text/html", "raw", http.StatusOK, "text/plain; charset=utf-8", "raw"},
+		{"text/csv", NewError("not found", StatusNotFound), http.StatusNotFound, "application/json;charset=utf-8", `{"error":"not found"}`},
+		{"text/html", NewError("not found", StatusNotFound), http.StatusNotFound, "application/json;charset=utf-8", `{"error":"not found"}`},
+	}
+
+	responser := NewNegotiatingResponser()
+	for i, tt := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://localhost/", nil)
+		if tt.Accept != "" {
+			r.Header.Set("Accept", tt.Accept)
+		}
+		c := &Context{Request: r, ResponseWriter: w}
+
+		code, err := response(responser, c, w, tt.Result)
+		if err != nil {
+			t.Errorf("case %v: err = %v", i, err)
+		}
+		if code != tt.Code || w.Code != tt.Code {
+			t.Errorf("case %v: code = %v %v; want %v", i, code, w.Code, tt.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.ContentType {
+			t.Errorf("case %v: content type = %v; want %v", i, ct, tt.ContentType)
+		}
+		if w.Body.String() != tt.Body {
+			t.Errorf("case %v: body = %q; want %q", i, w.Body, tt.Body)
+		}
+	}
+
+	// msgpack
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://localhost/", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	responser.ResponseContext(&Context{Request: r, ResponseWriter: w}, rows[1])
+
+	var row Row
+	dec := msgpack.NewDecoder(w.Body)
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&row); err != nil || row != rows[1] {
+		t.Errorf("msgpack = %v %v; want %v", row, err, rows[1])
+	}
+}
+
+type testWriteable struct{}
+
+func (tw *testWriteable) OnWrite(w http.ResponseWriter) error {
+	w.WriteHeader(http.StatusAccepted)
+	_, err := w.Write([]byte("written"))
+	return err
+}
+
+func (tw *testWriteable) StatusCode() int {
+	return http.StatusAccepted
+}
+
+func TestEnvelopeResponser(t *testing.T) {
+	testCases := []struct {
+		ForceOK bool
+		Result  interface{}
+		Code    int
+		Body    string
+	}{
+		{false, nil, http.StatusOK, `{"code":200,"data":null,"error":null,"request_id":"7"}`},
+		{false, "ok", http.StatusOK, `{"code":200,"data":"ok","error":null,"request_id":"7"}`},
+		{false, Result{"id": 1}.SetStatusCode(201), 201, `{"code":201,"data":{"id":1},"error":null,"request_id":"7"}`},
+		{false, NewError("not found", StatusNotFound), StatusNotFound, `{"code":404,"data":null,"error":{"error":"not found"},"request_id":"7"}`},
+		{true, errors.New("db"), http.StatusOK, `{"code":500,"data":null,"error":{"error":"server error","reason":"internal"},"request_id":"7"}`},
+		{false, []byte("raw"), http.StatusOK, "raw"},
+		{false, new(testWriteable), http.StatusAccepted, "written"},
+	}
+
+	for i, tt := range testCases {
+		responser := NewEnvelopeResponser(nil)
+		responser.ForceOK = tt.ForceOK
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://localhost/", nil)
+		c := &Context{Request: r, RequestId: "7", ResponseWriter: w}
+
+		code, err := response(responser, c, w, tt.Result)
+		if err != nil {
+			t.Errorf("case %v: err = %v", i, err)
+		}
+		if code != tt.Code || w.Code != tt.Code {
+			t.Errorf("case %v: code = %v %v; want %v", i, code, w.Code, tt.Code)
+		}
+		if w.Body.String() != tt.Body {
+			t.Errorf("case %v: body = %v; want %v", i, w.Body, tt.Body)
+		}
+	}
+}
+
+type testHeaderResult struct {
+	Id int `json:"id"`
+}
+
+func (r *testHeaderResult) Headers() http.Header {
+	return http.Header{"Location": {"/item/1"}, "Cache-Control": {"no-cache"}}
+}
+
+func (r *testHeaderResult) StatusCode() int {
+	return http.StatusCreated
+}
+
+func TestDefaultResponserHeaders(t *testing.T) {
+	testCases := []struct {
+		Result      interface{}
+		Code        int
+		Body        string
+		ContentType string
+		Location    string
+	}{
+		{NewError("not found", StatusNotFound), StatusNotFound, `{"error":"not found"}`, "application/json;charset=utf-8", ""},
+		{&testHeaderResult{1}, http.StatusCreated, `{"id":1}`, "application/json;charset=utf-8", "/item/1"},
+		{new(testWriteable), http.StatusAccepted, "written", "", ""},
+		{func() {}, StatusInternalServerError, "", "", ""},
+	}
+
+	for i, tt := range testCases {
+		responser := new(DefaultResponser)
+		w := httptest.NewRecorder()
+
+		code, _ := responser.Response(w, tt.Result)
+
+		resp := w.Result() // headers at the time of WriteHeader
+		if code != tt.Code || resp.StatusCode != tt.Code {
+			t.Errorf("case %v: code = %v %v; want %v", i, code, resp.StatusCode, tt.Code)
+		}
+		if w.Body.String() != tt.Body {
+			t.Errorf("case %v: body = %v; want %v", i, w.Body, tt.Body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != tt.ContentType {
+			t.Errorf("case %v: content type = %v; want %v", i, ct, tt.ContentType)
+		}
+		if l := resp.Header.Get("Location"); l != tt.Location {
+			t.Errorf("case %v: location = %v; want %v", i, l, tt.Location)
+		}
+	}
+}
+
+func TestResultHelpers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modtime := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	testCases := []struct {
+		Result interface{}
+		Header http.Header // request headers
+		Code   int
+		Body   string
+		Want   http.Header // response headers
+	}{
+		{Redirect("/login", http.StatusFound), nil, http.StatusFound, "", http.Header{"Location": {"/login"}}},
+		{NoContent(), nil, http.StatusNoContent, "", nil},
+		{Created("/item/1", Result{"id": 1}), nil, http.StatusCreated, `{"id":1}`,
+			http.Header{"Location": {"/item/1"}, "Content-Type": {"application/json;charset=utf-8"}}},
+		{Raw("image/png", []byte("png")), nil, http.StatusOK, "png", http.Header{"Content-Type": {"image/png"}}},
+		{File(path), nil, http.StatusOK, "hello world", http.Header{"Content-Type": {"text/plain; charset=utf-8"}}},
+		{File(path), http.Header{"Range": {"bytes=0-4"}}, http.StatusPartialContent, "hello", nil},
+		{File(path), http.Header{"If-Modified-Since": {modtime}}, http.StatusNotModified, "", nil},
+		{File(filepath.Join(dir, "none")), nil, http.StatusNotFound, `{"error":"file not found","request_id":"7"}`, nil},
+		{Attachment("a b.csv", strings.NewReader("1,2")), nil, http.StatusOK, "1,2",
+			http.Header{"Content-Disposition": {`attachment; filename="a b.csv"`}, "Content-Type": {"text/csv; charset=utf-8"}}},
+	}
+
+	for i, tt := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://localhost/", nil)
+		for k, vs := range tt.Header {
+			r.Header[k] = vs
+		}
+		r.Header.Set(RequestIdHeader, "7")
+		c, _ := newContext(w, r)
+
+		code, _ := response(new(DefaultResponser), c, c.ResponseWriter, tt.Result)
+
+		if w.Code != tt.Code || code != tt.Code {
+			t.Errorf("case %v: code = %v, returned %v; want %v", i, w.Code, code, tt.Code)
+		}
+		if w.Body.String() != tt.Body {
+			t.Errorf("case %v: body = %v; want %v", i, w.Body, tt.Body)
+		}
+		for k := range tt.Want {
+			if w.Header().Get(k) != tt.Want.Get(k) {
+				t.Errorf("case %v: header %v = %v; want %v", i, k, w.Header().Get(k), tt.Want.Get(k))
+			}
+		}
+	}
+}
+
+func TestFileErrorByResponser(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.SetResponser(NewProblemResponser(nil))
+	w.Handle("GET", "/file", func(c *Context) interface{} {
+		return File(filepath.Join(t.TempDir(), "none"))
+	})
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/file", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != MediaTypeProblem {
+		t.Errorf("code = %v, content type = %v; want 404 %v", rec.Code, rec.Header().Get("Content-Type"), MediaTypeProblem)
+	}
+	if !strings.Contains(rec.Body.String(), `"title":"file not found"`) {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+func TestProblemResponser(t *testing.T) {
+	invalid := NewErrorMsg("invalid argument", "'id' is required", StatusBadRequest).WithReason(ReasonInvalidArgument)
+	invalid.AddDetail("id", LocationQuery, FieldRequired, "")
+
+	testCases := []struct {
+		ByAccept    bool
+		Accept      string
+		Result      interface{}
+		Code        int
+		ContentType string
+		Body        string
+	}{
+		{false, "", invalid, StatusBadRequest, MediaTypeProblem,
+			`{"type":"https://example.com/probs/invalid_argument","title":"invalid argument","status":400,"detail":"'id' is required","instance":"/users","request_id":"7","reason":"invalid_argument","errors":[{"field":"id","location":"query","code":"required"}]}`},
+		{false, "", errors.New("db"), StatusInternalServerError, MediaTypeProblem,
+			`{"type":"https://example.com/probs/internal","title":"server error","status":500,"instance":"/users","request_id":"7","reason":"internal"}`},
+		{false, "", NewError("", StatusNotFound), StatusNotFound, MediaTypeProblem,
+			`{"type":"about:blank","title":"Not Found","status":404,"instance":"/users","request_id":"7"}`},
+		{false, "", Result{"id": 1}, StatusOK, "application/json;charset=utf-8", `{"id":1}`},
+		{true, "application/json", NewError("not found", StatusNotFound), StatusNotFound, "application/json;charset=utf-8", `{"error":"not found","request_id":"7"}`},
+		{true, "application/json, application/problem+json", NewError("not found", StatusNotFound), StatusNotFound, MediaTypeProblem,
+			`{"type":"about:blank","title":"not found","status":404,"instance":"/users","request_id":"7"}`},
+	}
+
+	for i, tt := range testCases {
+		responser := NewProblemResponser(nil)
+		responser.ByAccept = tt.ByAccept
+		responser.TypeBase = "https://example.com/probs/"
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://localhost/users?name=x", nil)
+		if tt.Accept != "" {
+			r.Header.Set("Accept", tt.Accept)
+		}
+		c := &Context{Request: r, RequestId: "7", ResponseWriter: w}
+
+		code, err := response(responser, c, w, tt.Result)
+		if err != nil {
+			t.Errorf("case %v: err = %v", i, err)
+		}
+		if code != tt.Code || w.Code != tt.Code {
+			t.Errorf("case %v: code = %v %v; want %v", i, code, w.Code, tt.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.ContentType {
+			t.Errorf("case %v: content type = %v; want %v", i, ct, tt.ContentType)
+		}
+		if w.Body.String() != tt.Body {
+			t.Errorf("case %v: body = %v; want %v", i, w.Body, tt.Body)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseState tells what has been written to the client, see Context.ResponseState.
+type ResponseState struct {
+	Status     int           // status code sent, 0 if the header has not been sent
+	Bytes      int64         // bytes of body written
+	HeaderSent bool          // the header has been sent and can't be changed
+	FirstByte  time.Duration // time to first byte since the request was received, 0 if not sent
+	Hijacked   bool          // the connection has been hijacked, such as by WebSocket
+}
+
+// responseWriter wraps the http.ResponseWriter of a request to record what is written to the
+// client. It keeps http.Flusher, http.Hijacker and io.ReaderFrom of the underlying writer.
+type responseWriter struct {
+	http.ResponseWriter
+
+	start time.Time
+	state ResponseState
+}
+
+func newResponseWriter(w http.ResponseWriter, start time.Time) *responseWriter {
+	return &responseWriter{ResponseWriter: w, start: start}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.state.HeaderSent {
+		w.ResponseWriter.WriteHeader(code) // superfluous, let net/http complain
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		return // informational, the final header is to be sent
+	}
+	w.sent(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.state.HeaderSent {
+		w.sent(StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.state.Bytes += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.state.HeaderSent {
+		w.sent(StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+	}
+	w.state.Bytes += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if !w.state.HeaderSent {
+		w.sent(StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.state.Hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) sent(code int) {
+	w.state.Status = code
+	w.state.HeaderSent = true
+	w.state.FirstByte = time.Since(w.start)
+}
+
+var _ http.Flusher = (*responseWriter)(nil)
+var _ http.Hijacker = (*responseWriter)(nil)
+var _ io.ReaderFrom = (*responseWriter)(nil)
+
+// Get what has been written to the client. The status may differ from the one returned by
+// the Responser, for example a handler writes c.ResponseWriter by itself.
+func (c *Context) ResponseState() ResponseState {
+	if c.writer == nil {
+		return ResponseState{}
+	}
+	return c.writer.state
+}
@@ -2,7 +2,12 @@ package web
 
 import (
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 var ResultOK = Result{"result": "ok"}
@@ -33,10 +38,222 @@ var _ StatusCode = (*Result)(nil)
 
 ///////////////////////////////////////////////////////////////////////////////
 
+// Payload is a result with status code and headers. The body is written as usual by the
+// Responser, or nothing if it's nil. See Created, NoContent and Redirect.
+type Payload struct {
+	Code   int
+	Header http.Header
+	Body   interface{}
+}
+
+// Response 201 Created with the location of the new resource.
+func Created(location string, body interface{}) *Payload {
+	p := &Payload{Code: http.StatusCreated, Header: make(http.Header), Body: body}
+	if location != "" {
+		p.Header.Set("Location", location)
+	}
+	return p
+}
+
+// Response 204 No Content.
+func NoContent() *Payload {
+	return &Payload{Code: http.StatusNoContent}
+}
+
+// Redirect to the url with a code in 3xx, such as http.StatusFound.
+func Redirect(url string, code int) *Payload {
+	p := &Payload{Code: code, Header: make(http.Header)}
+	p.Header.Set("Location", url)
+	return p
+}
+
+func (p *Payload) StatusCode() int {
+	return p.Code
+}
+
+func (p *Payload) Headers() http.Header {
+	return p.Header
+}
+
+func (p *Payload) String() string {
+	if p.Body == nil {
+		return fmt.Sprintf("%d %s", p.Code, http.StatusText(p.Code))
+	}
+	return fmt.Sprintf("%d %s %v", p.Code, http.StatusText(p.Code), p.Body)
+}
+
+var _ StatusCode = (*Payload)(nil)
+var _ Headers = (*Payload)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// RawResult writes the data with a content type.
+type RawResult struct {
+	ContentType string
+	Data        []byte
+}
+
+func Raw(contentType string, data []byte) *RawResult {
+	return &RawResult{ContentType: contentType, Data: data}
+}
+
+func (r *RawResult) Headers() http.Header {
+	return http.Header{"Content-Type": {r.ContentType}}
+}
+
+func (r *RawResult) OnWrite(w http.ResponseWriter) error {
+	_, err := w.Write(r.Data)
+	return err
+}
+
+func (r *RawResult) String() string {
+	return fmt.Sprintf("raw %s %d bytes", r.ContentType, len(r.Data))
+}
+
+var _ Writeable = (*RawResult)(nil)
+var _ Headers = (*RawResult)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// FileResult serves a file by http.ServeContent, which supports Range, If-Modified-Since etc.
+// 404 is responsed by the Responser of the Web if the file doesn't exist.
+type FileResult struct {
+	Path string
+}
+
+func File(path string) *FileResult {
+	return &FileResult{Path: path}
+}
+
+func (f *FileResult) OnWrite(w http.ResponseWriter) error {
+	return f.serve(nil, w)
+}
+
+func (f *FileResult) OnWriteContext(c *Context) error {
+	return f.serve(c, c.ResponseWriter)
+}
+
+// the context is nil if written by OnWrite
+func (f *FileResult) serve(c *Context, w http.ResponseWriter) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return writeError(c, w, NewError("file not found", fileErrorCode(err)))
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return writeError(c, w, NewError("file not found", fileErrorCode(err)))
+	}
+
+	if c == nil {
+		w.Header().Set("Content-Type", contentTypeByName(info.Name()))
+		_, err = io.Copy(w, file)
+		return err
+	}
+
+	http.ServeContent(w, c.Request, info.Name(), info.ModTime(), file)
+	return nil
+}
+
+func (f *FileResult) String() string {
+	return "file " + f.Path
+}
+
+func fileErrorCode(err error) int {
+	if os.IsPermission(err) {
+		return StatusForbidden
+	}
+	return StatusNotFound
+}
+
+var _ ContextWriteable = (*FileResult)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// AttachmentResult makes the client download the content as a file with the name.
+// Range requests are supported if the reader is an io.ReadSeeker. The reader is closed
+// after written if it's an io.Closer.
+type AttachmentResult struct {
+	Name   string
+	Reader io.Reader
+}
+
+func Attachment(name string, reader io.Reader) *AttachmentResult {
+	return &AttachmentResult{Name: name, Reader: reader}
+}
+
+func (a *AttachmentResult) Headers() http.Header {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})
+	return http.Header{
+		"Content-Disposition": {disposition},
+		"Content-Type":        {contentTypeByName(a.Name)},
+	}
+}
+
+func (a *AttachmentResult) OnWrite(w http.ResponseWriter) error {
+	return a.serve(w, nil)
+}
+
+func (a *AttachmentResult) OnWriteContext(c *Context) error {
+	return a.serve(c.ResponseWriter, c.Request)
+}
+
+func (a *AttachmentResult) serve(w http.ResponseWriter, r *http.Request) error {
+	if closer, ok := a.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if rs, ok := a.Reader.(io.ReadSeeker); ok && r != nil {
+		http.ServeContent(w, r, a.Name, time.Time{}, rs)
+		return nil
+	}
+
+	_, err := io.Copy(w, a.Reader)
+	return err
+}
+
+func (a *AttachmentResult) String() string {
+	return "attachment " + a.Name
+}
+
+var _ ContextWriteable = (*AttachmentResult)(nil)
+var _ Headers = (*AttachmentResult)(nil)
+
+func contentTypeByName(name string) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Write an error when a Writeable fails before writing anything, by the Responser of the Web
+// if there's a context, or in JSON by DefaultResponser otherwise.
+func writeError(c *Context, w http.ResponseWriter, e *Error) error {
+	var r Responser = new(DefaultResponser)
+	if c != nil && c.responser != nil {
+		r = c.responser
+	}
+	response(r, c, w, e)
+	return e
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Error is responsed as {"error": Err, "reason": Reason, "message": Message}. Err is a short
+// description, Reason is a stable code for machines, such as ReasonInvalidArgument, and Message
+// tells more about the error. The wrapped error is not responsed, but in Cause in debug mode.
 type Error struct {
-	Err     string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"-"`
+	Err     string       `json:"error"`
+	Reason  string       `json:"reason,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Details []FieldError `json:"details,omitempty"`
+	Cause   string       `json:"cause,omitempty"` // the wrapped error, only filled in debug mode
+	Code    int          `json:"-"`
+
+	RequestId string `json:"request_id,omitempty"` // filled when responsed with a context
+
+	err error // wrapped
 }
 
 func NewError(e string, code int) *Error {
@@ -51,24 +268,103 @@ func NewErrorMsg(e, msg string, code int) *Error {
 	return err
 }
 
+// Wrap an internal error, which is kept for errors.Is/As and logging, but not responsed.
+//
+//	if err != nil {
+//		return web.WrapError(err, "query failed", web.StatusInternalServerError)
+//	}
+func WrapError(err error, e string, code int) *Error {
+	return NewError(e, code).Wrap(err)
+}
+
 func (e *Error) Error() string {
-	return fmt.Sprintf("%s %s", e.Err, e.Message)
+	s := e.Err
+	if e.Message != "" {
+		s += " " + e.Message
+	}
+	if e.err != nil {
+		s += ": " + e.err.Error()
+	}
+	return s
 }
 
 func (e *Error) StatusCode() int {
 	return e.Code
 }
 
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Errors with the same Reason are equal for errors.Is, so that a sentinel can be compared
+// with a copy of it.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason != "" && t.Reason == e.Reason
+}
+
+// Set the reason code.
+func (e *Error) WithReason(reason string) *Error {
+	e.Reason = reason
+	return e
+}
+
+// Set the wrapped error.
+func (e *Error) Wrap(err error) *Error {
+	e.err = err
+	return e
+}
+
+// Append a FieldError to the error details.
+func (e *Error) AddDetail(field, location, code, msg string) *Error {
+	e.Details = append(e.Details, FieldError{Field: field, Location: location, Code: code, Message: msg})
+	return e
+}
+
 var _ error = (*Error)(nil)
 var _ StatusCode = (*Error)(nil)
 
 ///////////////////////////////////////////////////////////////////////////////
 
+// FieldError tells which request parameter is invalid and why.
+// It is filled into Error.Details by Scheme and ParseParams.
+type FieldError struct {
+	Field    string `json:"field"`
+	Location string `json:"location,omitempty"` // one of LocationPath, LocationQuery, LocationBody, LocationHeader, LocationCookie, LocationContext
+	Code     string `json:"code"`               // one of FieldRequired, FieldInvalid
+	Message  string `json:"message,omitempty"`
+}
+
+const (
+	LocationPath   = "path"
+	LocationQuery  = "query"
+	LocationBody   = "body"
+	LocationHeader = "header"
+	LocationCookie = "cookie"
+
+	// Not a location of params, but values set by Context.Set, such as the user set by an
+	// auth middleware. Request params can never write them.
+	LocationContext = "ctx"
+)
+
+const (
+	FieldRequired = "required" // the parameter is required but missing
+	FieldInvalid  = "invalid"  // the parameter can't be converted to the field type
+)
+
+///////////////////////////////////////////////////////////////////////////////
+
 const (
-	StatusOK                  = http.StatusOK                  // 200
-	StatusBadRequest          = http.StatusBadRequest          // 400
-	StatusUnauthorized        = http.StatusUnauthorized        // 401
-	StatusForbidden           = http.StatusForbidden           // 403
-	StatusNotFound            = http.StatusNotFound            // 404
-	StatusInternalServerError = http.StatusInternalServerError // 500
+	StatusOK                   = http.StatusOK                   // 200
+	StatusNotModified          = http.StatusNotModified          // 304
+	StatusBadRequest           = http.StatusBadRequest           // 400
+	StatusUnauthorized         = http.StatusUnauthorized         // 401
+	StatusForbidden            = http.StatusForbidden            // 403
+	StatusNotFound             = http.StatusNotFound             // 404
+	StatusNotAcceptable        = http.StatusNotAcceptable        // 406
+	StatusPreconditionFailed   = http.StatusPreconditionFailed   // 412
+	StatusUnsupportedMediaType = http.StatusUnsupportedMediaType // 415
+	StatusInternalServerError  = http.StatusInternalServerError  // 500
+	StatusServiceUnavailable   = http.StatusServiceUnavailable   // 503
+	StatusGatewayTimeout       = http.StatusGatewayTimeout       // 504
 )
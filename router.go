@@ -30,6 +30,11 @@ type Router interface {
 	// the same url.
 	Handle(method string, path string, fn Handler) *MiddlewaresManager
 
+	// Register a WebSocket handler for this url with GET method. The request is upgraded
+	// after all middlewares passed, so that auth and rate limiting still apply. An error
+	// from middlewares is responsed as usual without upgrading.
+	HandleWebSocket(path string, fn WebSocketHandler) *MiddlewaresManager
+
 	// Append a middleware to this router. Middlewares will applied to handler in sequence.
 	Append(midd Middleware)
 
@@ -69,6 +74,17 @@ func (r *router) Handle(method string, urlpath string, fn Handler) *MiddlewaresM
 	return midwares
 }
 
+func (r *router) HandleWebSocket(urlpath string, fn WebSocketHandler) *MiddlewaresManager {
+	if fn == nil {
+		panic("func is nil")
+	}
+	upgrade := &wsUpgrade{web: r.web, fn: fn}
+
+	return r.Handle(GET, urlpath, func(c *Context) interface{} {
+		return upgrade
+	})
+}
+
 func (r *router) SubRouter(basePath string) Router {
 	base := path.Join(r.base, basePath)
 	midwares := r.midwares.duplicate()
@@ -2,24 +2,396 @@ package web
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/tiaotiao/mapstruct"
 )
 
 // Tag name for Scheme.
 var SchemeTagName = "web"
 
+// Scheme converts vals into the struct pointed by dst, by the indication of struct tags.
+// If some fields failed, the returned *Error carries a FieldError for each of them in Details.
+//
+// The tag is formatted as "name,options...". Besides "required" or a default value, an option
+// can be a location which the parameter must come from:
+//
+//	Id    int64  `web:"id,path"`             // only from url path
+//	Query string `web:"q,query"`             // only from url query
+//	Token string `web:"token,header=X-Token"` // from request header X-Token
+//	Sid   string `web:"sid,cookie,required"`  // from cookie sid
+//
+// The ctx option injects a value set by Context.Set, such as by a middleware. It's assigned
+// as is, so the type must be assignable to the field:
+//
+//	User *User `web:"user,ctx,required"` // c.Set("user", user)
+//
+// The secret option marks a parameter to be redacted by loggers, see Redaction:
+//
+//	Password string `web:"password,secret"`
+//
+// Headers and cookies are only available through Context.Scheme. Here the location of
+// path, query and body is ignored, since vals has been merged.
 func Scheme(vals map[string]interface{}, dst interface{}) (err error) {
-	err = mapstruct.Map2StructTag(vals, dst, SchemeTagName)
-	if err != nil {
-		return NewErrorMsg("invalid argument", err.Error(), StatusBadRequest)
+	return scheme(vals, nil, dst)
+}
+
+func SchemeParam(vals map[string]interface{}, dst interface{}, tag string) (err error) {
+	return schemeParam(vals, nil, dst, tag)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func scheme(vals map[string]interface{}, c *Context, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		err := mapstruct.Map2StructTag(vals, dst, SchemeTagName)
+		if err != nil {
+			return NewErrorMsg("invalid argument", err.Error(), StatusBadRequest).WithReason(ReasonInvalidArgument)
+		}
+		return nil
+	}
+
+	var details []FieldError
+	schemeStruct(vals, c, v.Elem(), &details)
+
+	return invalidArgument(details)
+}
+
+func schemeStruct(vals map[string]interface{}, c *Context, v reflect.Value, details *[]FieldError) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup(SchemeTagName)
+
+		// embedded struct without tag, scheme its fields as if they were ours
+		if f.Anonymous && !ok && f.Type.Kind() == reflect.Struct {
+			schemeStruct(vals, c, v.Field(i), details)
+			continue
+		}
+
+		if f.PkgPath != "" || tag == "-" { // unexported or ignored
+			continue
+		}
+
+		st := parseSchemeTag(tag)
+		if st.name == "" {
+			st.name = strings.ToLower(f.Name)
+		}
+
+		fe := schemeField(vals, c, v.Field(i).Addr().Interface(), st)
+		if fe != nil {
+			*details = append(*details, *fe)
+		}
+	}
+}
+
+func schemeParam(vals map[string]interface{}, c *Context, dst interface{}, tag string) error {
+	st := parseSchemeTag(tag)
+
+	fe := schemeField(vals, c, dst, st)
+	if fe != nil {
+		fe.Message = fmt.Sprintf("'%v' %v", st.name, fe.Message)
+		return invalidArgument([]FieldError{*fe})
 	}
 	return nil
 }
 
-func SchemeParam(vals map[string]interface{}, dst interface{}, tag string) (err error) {
-	err = mapstruct.Map2Field(vals, dst, tag)
-	if err != nil {
-		return NewErrorMsg("invalid argument", fmt.Sprintf("'%v' %v", tag, err.Error()), StatusBadRequest)
+func schemeField(vals map[string]interface{}, c *Context, dst interface{}, st *schemeTag) *FieldError {
+	if st.location == LocationContext {
+		return schemeContext(c, dst, st) // never from vals, even without a context
+	}
+
+	var location string
+
+	if c != nil {
+		location = c.Sources[st.name]
+		if st.secret {
+			c.setSecret(st.name)
+			c.setSecret(st.paramKey())
+		}
+	}
+
+	if st.location != "" && (c != nil || st.location == LocationHeader || st.location == LocationCookie) {
+		location = st.location
+		vals = make(map[string]interface{}, 1)
+		if v, ok := lookupParam(c, st.location, st.paramKey()); ok {
+			vals[st.name] = v
+		}
+	}
+
+	if v := reflect.ValueOf(dst).Elem(); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		if vs, loc, ok := sliceValues(vals, c, st); ok {
+			return schemeSlice(v, vs, st.name, loc)
+		}
+	}
+
+	err := mapstruct.Map2Field(vals, dst, st.mapTag())
+	if err == nil {
+		return nil
+	}
+
+	fe := &FieldError{Field: st.name, Location: location, Code: FieldInvalid, Message: err.Error()}
+	if _, ok := vals[st.name]; !ok {
+		fe.Code = FieldRequired
+	}
+	return fe
+}
+
+func schemeContext(c *Context, dst interface{}, st *schemeTag) *FieldError {
+	var v interface{}
+	var ok bool
+	if c != nil {
+		v, ok = c.Get(st.paramKey())
+	}
+	if !ok || v == nil {
+		if st.required() {
+			return &FieldError{Field: st.name, Location: LocationContext, Code: FieldRequired, Message: "is required"}
+		}
+		return nil
+	}
+
+	field := reflect.ValueOf(dst).Elem()
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(field.Type()) {
+		msg := fmt.Sprintf("%v is not assignable to %v", rv.Type(), field.Type())
+		return &FieldError{Field: st.name, Location: LocationContext, Code: FieldInvalid, Message: msg}
+	}
+	field.Set(rv)
+	return nil
+}
+
+func lookupParam(c *Context, location string, key string) (interface{}, bool) {
+	if c == nil || c.Request == nil {
+		return nil, false
+	}
+	switch location {
+	case LocationHeader:
+		if vs, ok := c.Request.Header[http.CanonicalHeaderKey(key)]; ok && len(vs) > 0 {
+			return vs[0], true
+		}
+	case LocationCookie:
+		if ck, err := c.Request.Cookie(key); err == nil {
+			return ck.Value, true
+		}
+	default:
+		v, ok := c.params[location][key]
+		return v, ok
+	}
+	return nil, false
+}
+
+// Get the values of a slice field. It returns false if it should be left to mapstruct,
+// which splits a single string by comma or unmarshals it as a json array.
+func sliceValues(vals map[string]interface{}, c *Context, st *schemeTag) (vs []string, location string, ok bool) {
+	switch {
+	case st.location == LocationHeader || st.location == LocationCookie:
+		if c == nil || c.Request == nil {
+			return nil, "", false
+		}
+		form := make(url.Values)
+		if st.location == LocationHeader {
+			form[st.paramKey()] = c.Request.Header.Values(st.paramKey())
+		} else if ck, err := c.Request.Cookie(st.paramKey()); err == nil {
+			form.Set(st.paramKey(), ck.Value)
+		}
+		vs, location = st.formValues(form), st.location
+
+	case c == nil:
+		form := make(url.Values, len(vals))
+		for k, v := range vals {
+			switch v := v.(type) {
+			case string:
+				form[k] = []string{v}
+			case []string:
+				form[k] = v
+			}
+		}
+		vs = st.formValues(form)
+
+	case st.location != "":
+		vs, location = st.formValues(c.forms[st.location]), st.location
+
+	default:
+		for _, loc := range c.paramsPrecedence() {
+			if vs = st.formValues(c.forms[loc]); vs != nil {
+				location = loc
+				break
+			}
+		}
+	}
+
+	if vs == nil {
+		return nil, "", false
 	}
+	if st.style == "" && len(vs) == 1 && (c == nil || isJSONArray(vs[0])) {
+		return nil, "", false // split by comma for a map of vals, as before
+	}
+
+	if st.style == SliceComma {
+		var items []string
+		for _, v := range vs {
+			if v != "" {
+				items = append(items, strings.Split(v, ",")...)
+			}
+		}
+		vs = items
+	}
+	return vs, location, true
+}
+
+func isJSONArray(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]")
+}
+
+func schemeSlice(v reflect.Value, vs []string, name string, location string) *FieldError {
+	slice := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+
+	for i, s := range vs {
+		err := mapstruct.Map2Field(map[string]interface{}{name: s}, slice.Index(i).Addr().Interface(), name)
+		if err != nil {
+			msg := fmt.Sprintf("[%v] %v", i, err.Error())
+			return &FieldError{Field: name, Location: location, Code: FieldInvalid, Message: msg}
+		}
+	}
+
+	if len(vs) == 0 {
+		slice = reflect.Zero(v.Type())
+	}
+	v.Set(slice)
 	return nil
 }
+
+func invalidArgument(details []FieldError) error {
+	if len(details) == 0 {
+		return nil
+	}
+	e := NewErrorMsg("invalid argument", details[0].Message, StatusBadRequest).WithReason(ReasonInvalidArgument)
+	e.Details = details
+	return e
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type schemeTag struct {
+	name     string
+	location string   // empty means any location
+	key      string   // the name in that location, e.g. header name. Use name if empty.
+	style    string   // style of slice field, see SliceComma etc.
+	options  []string // "required" or default value, passed to mapstruct
+	secret   bool     // redacted in logs
+}
+
+// The option of a tag to redact the parameter in logs.
+const OptionSecret = "secret"
+
+// Styles of repeated params for slice fields, specified as an option of the tag:
+//
+//	Tags []string `web:"tag"`          // ?tag=a&tag=b, a single ?tag=a,b is one element "a,b"
+//	Tags []string `web:"tag,comma"`    // ?tag=a,b&tag=c, every value is split by comma
+//	Tags []string `web:"tag,brackets"` // ?tag[]=a&tag[]=b
+//	Tags []string `web:"tag,indexed"`  // ?tag[0]=a&tag[1]=b, sorted by index
+//
+// A single value of a json array, such as ?tag=["a","b"], is still unmarshaled. Scheme on a
+// map of vals, without the request, splits a single string by comma as before.
+const (
+	SliceComma    = "comma"
+	SliceBrackets = "brackets"
+	SliceIndexed  = "indexed"
+)
+
+func parseSchemeTag(tag string) *schemeTag {
+	parts := strings.Split(tag, ",")
+
+	st := new(schemeTag)
+	st.name = parts[0]
+
+	for _, opt := range parts[1:] {
+		loc, key := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			loc, key = opt[:i], opt[i+1:]
+		}
+
+		switch loc {
+		case LocationPath, LocationQuery, LocationBody, LocationHeader, LocationCookie, LocationContext:
+			st.location = loc
+			st.key = key
+		case SliceComma, SliceBrackets, SliceIndexed:
+			st.style = opt
+		case OptionSecret:
+			st.secret = true
+		default:
+			st.options = append(st.options, opt)
+		}
+	}
+	return st
+}
+
+func (st *schemeTag) paramKey() string {
+	if st.key != "" {
+		return st.key
+	}
+	return st.name
+}
+
+func (st *schemeTag) required() bool {
+	for _, opt := range st.options {
+		if opt == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *schemeTag) mapTag() string {
+	return strings.Join(append([]string{st.name}, st.options...), ",")
+}
+
+// Get values of this param from form by the slice style. Nil if not found.
+func (st *schemeTag) formValues(form url.Values) []string {
+	key := st.paramKey()
+
+	switch st.style {
+	case SliceBrackets:
+		return form[key+"[]"]
+
+	case SliceIndexed:
+		type item struct {
+			index int
+			value string
+		}
+		var items []item
+		for k, vs := range form {
+			if !strings.HasPrefix(k, key+"[") || !strings.HasSuffix(k, "]") || len(vs) == 0 {
+				continue
+			}
+			i, err := strconv.Atoi(k[len(key)+1 : len(k)-1])
+			if err != nil || i < 0 {
+				continue
+			}
+			items = append(items, item{i, vs[0]})
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].index < items[j].index })
+		vs := make([]string, len(items))
+		for i, it := range items {
+			vs[i] = it.value
+		}
+		return vs
+
+	default:
+		if vs := form[key]; len(vs) > 0 {
+			return vs
+		}
+		return nil
+	}
+}
@@ -2,7 +2,9 @@ package web
 
 import (
 	//"fmt"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -170,3 +172,107 @@ func TestScheme(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSchemeFieldErrors(t *testing.T) {
+	obj := struct {
+		Id    int    `web:"id,required"`
+		Name  string `web:"name,required"`
+		Count int
+	}{}
+
+	vals := map[string]interface{}{"id": "abc", "count": "10"}
+	c := &Context{Values: vals, Sources: map[string]string{"id": LocationPath, "count": LocationQuery}}
+
+	err := c.Scheme(&obj)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("err = %v; want *Error", err)
+	}
+	if e.Code != StatusBadRequest || e.Err != "invalid argument" {
+		t.Errorf("err = %v %v; want 400 invalid argument", e.Code, e.Err)
+	}
+
+	want := []struct{ Field, Location, Code string }{
+		{"id", LocationPath, FieldInvalid},
+		{"name", "", FieldRequired},
+	}
+	if len(e.Details) != len(want) {
+		t.Fatalf("details = %v; want %v", e.Details, want)
+	}
+	for i, w := range want {
+		d := e.Details[i]
+		if d.Field != w.Field || d.Location != w.Location || d.Code != w.Code || d.Message == "" {
+			t.Errorf("details[%v] = %+v; want %+v", i, d, w)
+		}
+	}
+	if obj.Count != 10 {
+		t.Errorf("Count = %v; want 10", obj.Count)
+	}
+
+	// scheme a single param
+	var id int
+	err = SchemeParam(map[string]interface{}{"id": "x"}, &id, "id")
+	if e, ok := err.(*Error); !ok || len(e.Details) != 1 || e.Details[0].Field != "id" {
+		t.Errorf("err = %v; want one detail of 'id'", err)
+	}
+}
+
+type testUser struct {
+	Name string
+}
+
+type testAuthMiddleware struct{}
+
+func (m *testAuthMiddleware) ServeMiddleware(c *Context) error {
+	if c.Request.Header.Get("X-Token") == "secret" {
+		c.Set("user", &testUser{Name: "gopher"})
+	}
+	return nil
+}
+
+func TestSchemeContext(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(&testAuthMiddleware{})
+	w.Handle("GET", "/me", func(c *Context, args struct {
+		User *testUser `web:"user,ctx,required"`
+		Name string    `web:"name"`
+	}) interface{} {
+		if u, ok := Value[*testUser](c, "user"); !ok || u != args.User {
+			t.Errorf("Value = %v %v", u, ok)
+		}
+		if _, ok := Value[string](c, "user"); ok {
+			t.Error("Value of a wrong type should fail")
+		}
+		return args.User.Name + " " + args.Name
+	})
+
+	// params never write ctx values
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/me?user=admin&name=x", nil)
+	r.Header.Set("X-Token", "secret")
+	w.ServeHTTP(rec, r)
+	if rec.Body.String() != "gopher x" {
+		t.Errorf("body = %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/me?user=admin", nil))
+	if rec.Code != StatusBadRequest || !strings.Contains(rec.Body.String(), `"location":"ctx","code":"required"`) {
+		t.Errorf("code = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// without a context, or of a wrong type
+	var args struct {
+		User *testUser `web:"user,ctx"`
+	}
+	if err := Scheme(map[string]interface{}{"user": &testUser{}}, &args); err != nil || args.User != nil {
+		t.Errorf("Scheme = %v, %v", args.User, err)
+	}
+	c, _ := newContext(nil, httptest.NewRequest("GET", "/", nil))
+	c.Set("user", "admin")
+	err := c.Scheme(&args)
+	if e, ok := err.(*Error); !ok || len(e.Details) != 1 || e.Details[0].Code != FieldInvalid {
+		t.Errorf("err = %v; want an invalid detail", err)
+	}
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SlogLogger writes access logs by log/slog with structured fields:
+//
+//	{"time":"...","level":"INFO","msg":"request","request_id":"0192b3c4-5d6e-7f80-9a1b-2c3d4e5f6a7b","method":"GET","route":"/users/{id}",
+//	 "status":200,"latency_ms":1.25,"bytes":342,"remote_ip":"10.0.0.1","user_agent":"curl/8.0"}
+//
+// The level is WARN for 4xx and ERROR for 5xx, with the reason of error. Handlers can log by
+// Context.Logger with the same request fields. Headers and body params can be logged too,
+// redacted by Redaction. To use it:
+//
+//	w.SetLogger(web.NewSlogLogger(nil))
+type SlogLogger struct {
+	Logger *slog.Logger
+
+	Headers bool // log request headers
+	Params  bool // log params of request body
+}
+
+// Create a SlogLogger, which writes JSON lines into stdout if l is nil.
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+	return &SlogLogger{Logger: l}
+}
+
+func (l *SlogLogger) OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
+	attrs := append(requestAttrs(r, RequestIdFromContext(r.Context()), ""), responseAttrs(used, code, -1, result)...)
+	if l.Headers {
+		attrs = append(attrs, headerAttr(r.Header))
+	}
+	l.Logger.LogAttrs(context.Background(), statusLevel(code), "request", attrs...)
+}
+
+func (l *SlogLogger) OnLogContext(c *Context, start time.Time, used time.Duration, code int, result interface{}) {
+	st := c.ResponseState()
+	attrs := append(requestAttrs(c.Request, c.RequestId, c.Route), responseAttrs(used, code, st.Bytes, result)...)
+	if st.HeaderSent {
+		attrs = append(attrs, slog.Float64("ttfb_ms", float64(st.FirstByte)/float64(time.Millisecond)))
+	}
+	if l.Headers {
+		attrs = append(attrs, headerAttr(c.Request.Header))
+	}
+	if l.Params && len(c.params[LocationBody]) > 0 {
+		attrs = append(attrs, slog.String("params", Redaction.params(c.params[LocationBody], c.secretKeys())))
+	}
+	l.Logger.LogAttrs(c.Request.Context(), statusLevel(code), "request", attrs...)
+}
+
+var _ Logger = (*SlogLogger)(nil)
+var _ ContextLogger = (*SlogLogger)(nil)
+
+// A request-scoped logger with fields of request id, method, route, remote ip and user agent.
+// It's derived from the Logger of SlogLogger if set to the Web, otherwise slog.Default().
+//
+//	c.Logger().Info("user created", "user_id", u.Id)
+func (c *Context) Logger() *slog.Logger {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.slogLogger == nil {
+		base := c.slog
+		if base == nil {
+			base = slog.Default()
+		}
+		args := make([]interface{}, 0, 5)
+		for _, attr := range requestAttrs(c.Request, c.RequestId, c.Route) {
+			args = append(args, attr)
+		}
+		c.slogLogger = base.With(args...)
+	}
+	return c.slogLogger
+}
+
+func requestAttrs(r *http.Request, requestId string, route string) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 10)
+	if requestId != "" {
+		attrs = append(attrs, slog.String("request_id", requestId))
+	}
+	attrs = append(attrs, slog.String("method", r.Method))
+	if route != "" {
+		attrs = append(attrs, slog.String("route", route))
+	} else {
+		attrs = append(attrs, slog.String("path", r.URL.Path))
+	}
+	attrs = append(attrs,
+		slog.String("remote_ip", remoteIP(r)),
+		slog.String("user_agent", r.UserAgent()),
+	)
+	return attrs
+}
+
+// bytes is ignored if negative
+func responseAttrs(used time.Duration, code int, bytes int64, result interface{}) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("status", code),
+		slog.Float64("latency_ms", float64(used)/float64(time.Millisecond)),
+	}
+	if bytes >= 0 {
+		attrs = append(attrs, slog.Int64("bytes", bytes))
+	}
+	if err, ok := result.(error); ok {
+		e := ToError(err)
+		if e.Reason != "" {
+			attrs = append(attrs, slog.String("reason", e.Reason))
+		}
+		attrs = append(attrs, slog.String("error", Redaction.Result(err)))
+	}
+	return attrs
+}
+
+func headerAttr(h http.Header) slog.Attr {
+	h = Redaction.Header(h)
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, slog.String(name, strings.Join(h[name], ", ")))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+func statusLevel(code int) slog.Level {
+	switch {
+	case code >= 500:
+		return slog.LevelError
+	case code >= 400:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
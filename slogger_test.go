@@ -0,0 +1,65 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWeb()
+	w.SetLogger(NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	w.Handle("GET", "/users/{id}", func(c *Context) interface{} {
+		c.Logger().Info("get user", "user_id", c.Values["id"])
+		return Result{"id": c.Values["id"]}
+	})
+	w.Handle("GET", "/fail", func(c *Context) interface{} {
+		return NewError("invalid argument", StatusBadRequest).WithReason(ReasonInvalidArgument)
+	})
+
+	r := httptest.NewRequest("GET", "/users/12", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	w.ServeHTTP(httptest.NewRecorder(), r)
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("logs = %s", buf.String())
+	}
+	var logs []map[string]interface{}
+	for _, line := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("not json: %s", line)
+		}
+		logs = append(logs, m)
+	}
+
+	// the request-scoped logger
+	if l := logs[0]; l["msg"] != "get user" || l["user_id"] != "12" || l["route"] != "/users/{id}" || l["request_id"] == nil {
+		t.Errorf("handler log = %v", l)
+	}
+
+	// access logs
+	l := logs[1]
+	for k, v := range map[string]interface{}{
+		"level": "INFO", "msg": "request", "method": "GET", "route": "/users/{id}", "status": 200.0,
+		"bytes": float64(len(`{"id":"12"}`)), "remote_ip": "192.0.2.1", "user_agent": "test-agent",
+	} {
+		if l[k] != v {
+			t.Errorf("access log %s = %v; want %v", k, l[k], v)
+		}
+	}
+	if _, ok := l["latency_ms"].(float64); !ok || l["request_id"] != logs[0]["request_id"] {
+		t.Errorf("access log = %v", l)
+	}
+
+	if l = logs[2]; l["level"] != "WARN" || l["status"] != 400.0 || l["reason"] != ReasonInvalidArgument {
+		t.Errorf("error log = %v", l)
+	}
+}
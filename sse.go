@@ -0,0 +1,251 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default interval of heartbeat comments of SSE, to keep the connection alive through proxies.
+var SSEHeartbeat = 15 * time.Second
+
+// SSEEvent is an event of Server-Sent Events. Data is written as is if it's a string or []byte,
+// otherwise in JSON format.
+type SSEEvent struct {
+	Id    string
+	Event string
+	Data  interface{}
+	Retry time.Duration // reconnection time of client, ignored if 0
+}
+
+// SSEResult streams Server-Sent Events to the client. Return it from a Handler:
+//
+//	func Notify(c *web.Context) interface{} {
+//		return web.SSE(func(s *web.SSEStream) error {
+//			for {
+//				select {
+//				case n := <-notifications:
+//					if err := s.Send(&web.SSEEvent{Id: n.Id, Data: n}); err != nil {
+//						return err
+//					}
+//				case <-s.Done(): // client disconnected
+//					return nil
+//				}
+//			}
+//		})
+//	}
+//
+// The stream ends when fn returns. Heartbeats are sent while fn is running. Use
+// SSEStream.LastEventId to resume after the client reconnects.
+type SSEResult struct {
+	Heartbeat time.Duration // interval of heartbeats, SSEHeartbeat if 0, no heartbeat if negative
+	Retry     time.Duration // reconnection time sent at the beginning, ignored if 0
+
+	fn func(s *SSEStream) error
+
+	events   int
+	duration time.Duration
+}
+
+func SSE(fn func(s *SSEStream) error) *SSEResult {
+	return &SSEResult{fn: fn}
+}
+
+func (s *SSEResult) Headers() http.Header {
+	return http.Header{
+		"Content-Type":      {"text/event-stream"},
+		"Cache-Control":     {"no-cache"},
+		"Connection":        {"keep-alive"},
+		"X-Accel-Buffering": {"no"},
+	}
+}
+
+func (s *SSEResult) OnWrite(w http.ResponseWriter) error {
+	return s.serve(w, nil)
+}
+
+func (s *SSEResult) OnWriteContext(c *Context) error {
+	return s.serve(c.ResponseWriter, c.Request)
+}
+
+func (s *SSEResult) serve(w http.ResponseWriter, r *http.Request) error {
+	var start = time.Now()
+
+	stream := new(SSEStream)
+	stream.w = w
+	stream.flusher, _ = w.(http.Flusher)
+
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+		stream.lastEventId = r.Header.Get("Last-Event-ID")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream.ctx = ctx
+
+	defer func() {
+		cancel()
+		stream.wg.Wait() // no more heartbeats after return
+
+		s.events = stream.events
+		s.duration = time.Since(start)
+	}()
+
+	w.WriteHeader(StatusOK)
+	if s.Retry > 0 {
+		stream.write(fmt.Sprintf("retry: %d\n\n", s.Retry/time.Millisecond))
+	} else {
+		stream.write(": stream\n\n") // send headers to client
+	}
+
+	heartbeat := s.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = SSEHeartbeat
+	}
+	if heartbeat > 0 {
+		stream.wg.Add(1)
+		go stream.heartbeat(heartbeat)
+	}
+
+	err := s.fn(stream)
+	if err != nil && ctx.Err() != nil {
+		return nil // client disconnected
+	}
+	return err
+}
+
+// Number of events sent.
+func (s *SSEResult) Events() int {
+	return s.events
+}
+
+// Duration of the stream.
+func (s *SSEResult) Duration() time.Duration {
+	return s.duration
+}
+
+func (s *SSEResult) String() string {
+	return fmt.Sprintf("sse %d events in %v", s.events, s.duration)
+}
+
+var _ ContextWriteable = (*SSEResult)(nil)
+var _ Headers = (*SSEResult)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// SSEStream sends events to the client. It's safe to send from multiple goroutines.
+type SSEStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+
+	lastEventId string
+	events      int
+
+	lock sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// Send an event and flush it to the client. It fails if the client disconnected.
+func (s *SSEStream) Send(e *SSEEvent) error {
+	var b strings.Builder
+
+	if e.Id != "" {
+		fmt.Fprintf(&b, "id: %s\n", oneLine(e.Id))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", oneLine(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry/time.Millisecond)
+	}
+
+	var data string
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		d, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = string(d)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.writeLocked(b.String()); err != nil {
+		return err
+	}
+	s.events++
+	return nil
+}
+
+// The id of the last event received by the client before reconnecting, from the
+// Last-Event-ID header. Empty for a new connection.
+func (s *SSEStream) LastEventId() string {
+	return s.lastEventId
+}
+
+// Closed when the client disconnected or the stream ended.
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Context of the stream, canceled when the client disconnected or the stream ended.
+func (s *SSEStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *SSEStream) write(data string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.writeLocked(data)
+}
+
+func (s *SSEStream) writeLocked(data string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *SSEStream) heartbeat(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.write(": ping\n\n") != nil {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type chanLogger chan interface{}
+
+func (l chanLogger) OnLog(r *http.Request, start time.Time, used time.Duration, code int, result interface{}) {
+	l <- result
+}
+
+func TestSSE(t *testing.T) {
+	logs := make(chanLogger, 1)
+
+	w := NewWeb()
+	w.SetLogger(logs)
+	w.Handle("GET", "/events", func(c *Context) interface{} {
+		sse := SSE(func(s *SSEStream) error {
+			if err := s.Send(&SSEEvent{Id: s.LastEventId() + "1", Data: "hello\nworld"}); err != nil {
+				return err
+			}
+			if err := s.Send(&SSEEvent{Id: "2", Event: "json", Data: Result{"n": 2}}); err != nil {
+				return err
+			}
+			<-s.Done()
+			return s.Send(&SSEEvent{Data: "never"})
+		})
+		sse.Heartbeat = 10 * time.Millisecond
+		sse.Retry = time.Second
+		return sse
+	})
+
+	svr := httptest.NewServer(w)
+	defer svr.Close()
+
+	req, _ := http.NewRequest("GET", svr.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %v", ct)
+	}
+
+	want := []string{
+		"retry: 1000", "",
+		"id: 01", "data: hello", "data: world", "",
+		"id: 2", "event: json", `data: {"n":2}`, "",
+		": ping", "",
+	}
+	reader := bufio.NewReader(resp.Body)
+	for i, line := range want {
+		got, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = strings.TrimSuffix(got, "\n"); got != line {
+			t.Fatalf("line %v = %q; want %q", i, got, line)
+		}
+	}
+	resp.Body.Close() // disconnect
+
+	select {
+	case result := <-logs:
+		sse, ok := result.(*SSEResult)
+		if !ok {
+			t.Fatalf("result = %v; want *SSEResult", result)
+		}
+		if sse.Events() != 2 || sse.Duration() <= 0 {
+			t.Errorf("events = %v, duration = %v", sse.Events(), sse.Duration())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream not stopped after the client disconnected")
+	}
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Size of the buffer to write an item, which is flushed to the client after each item.
+var StreamFlushSize = 32 * 1024
+
+// StreamResult writes a large collection item by item, without marshaling all of them into memory.
+// Items are written as a JSON array, or as newline delimited JSON if NDJSON is true. Each item is
+// flushed to the client once written, so that a slow producer doesn't hold back the ones ready.
+// It stops without an error when the client disconnected, the same as SSE.
+//
+// If an error occurs during the streaming, the status code has been sent. The JSON array is left
+// unterminated so that the client can't parse it as a complete result.
+type StreamResult struct {
+	NDJSON bool
+
+	next func(ctx context.Context) (item interface{}, ok bool, err error)
+
+	items int
+}
+
+// Stream items from an iterator. The iterator returns false if there is no more items.
+//
+//	rows, _ := db.Query("SELECT id, name FROM users")
+//	return web.Stream(func() (interface{}, bool, error) {
+//		if !rows.Next() {
+//			return nil, false, rows.Err()
+//		}
+//		var u User
+//		err := rows.Scan(&u.Id, &u.Name)
+//		return &u, true, err
+//	})
+func Stream(next func() (item interface{}, ok bool, err error)) *StreamResult {
+	return &StreamResult{next: func(ctx context.Context) (interface{}, bool, error) {
+		return next()
+	}}
+}
+
+// Stream items received from a channel until it's closed. The ch must be a channel of any type.
+func StreamChan(ch interface{}) *StreamResult {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan {
+		panic(fmt.Sprintf("not a channel: %T", ch))
+	}
+
+	return &StreamResult{next: func(ctx context.Context) (interface{}, bool, error) {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		}
+		chosen, item, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return nil, false, ctx.Err()
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		return item.Interface(), true, nil
+	}}
+}
+
+func (s *StreamResult) Headers() http.Header {
+	if s.NDJSON {
+		return http.Header{"Content-Type": {"application/x-ndjson"}}
+	}
+	return http.Header{"Content-Type": {"application/json;charset=utf-8"}}
+}
+
+func (s *StreamResult) OnWrite(w http.ResponseWriter) error {
+	return s.serve(context.Background(), w)
+}
+
+func (s *StreamResult) OnWriteContext(c *Context) error {
+	return s.serve(c.Request.Context(), c.ResponseWriter)
+}
+
+func (s *StreamResult) serve(ctx context.Context, w http.ResponseWriter) error {
+	err := s.write(ctx, w)
+	if err != nil && ctx.Err() != nil {
+		return nil // client disconnected
+	}
+	return err
+}
+
+func (s *StreamResult) write(ctx context.Context, w http.ResponseWriter) error {
+	flusher, _ := w.(http.Flusher)
+	bw := bufio.NewWriterSize(w, StreamFlushSize)
+
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	enc := json.NewEncoder(bw) // the encoder appends a newline after each item
+	enc.SetEscapeHTML(false)
+
+	w.WriteHeader(StatusOK)
+	if !s.NDJSON {
+		bw.WriteString("[")
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, ok, err := s.next(ctx)
+		if err != nil {
+			flush()
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		if !s.NDJSON && s.items > 0 {
+			bw.WriteString(",")
+		}
+		if err = enc.Encode(item); err != nil {
+			flush()
+			return err
+		}
+		s.items++
+
+		if err = flush(); err != nil {
+			return err
+		}
+	}
+
+	if !s.NDJSON {
+		bw.WriteString("]")
+	}
+	return flush()
+}
+
+// Number of items written.
+func (s *StreamResult) Items() int {
+	return s.items
+}
+
+func (s *StreamResult) String() string {
+	return fmt.Sprintf("stream %d items", s.items)
+}
+
+var _ ContextWriteable = (*StreamResult)(nil)
+var _ Headers = (*StreamResult)(nil)
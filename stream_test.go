@@ -0,0 +1,127 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	logs := make(chanLogger, 1)
+
+	w := NewWeb()
+	w.SetLogger(logs)
+	w.Handle("GET", "/array", func(c *Context) interface{} {
+		i := 0
+		return Stream(func() (interface{}, bool, error) {
+			i++
+			return Result{"id": i}, i <= 3, nil
+		})
+	})
+	w.Handle("GET", "/ndjson", func(c *Context) interface{} {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; ; i++ {
+				select {
+				case ch <- i:
+				case <-c.Request.Context().Done():
+					return
+				}
+			}
+		}()
+		s := StreamChan(ch)
+		s.NDJSON = true
+		return s
+	})
+
+	svr := httptest.NewServer(w)
+	defer svr.Close()
+
+	// json array
+	resp, err := http.Get(svr.URL + "/array")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	var items []map[string]int
+	if err = json.Unmarshal(data, &items); err != nil || len(items) != 3 || items[2]["id"] != 3 {
+		t.Errorf("body = %s, err = %v", data, err)
+	}
+	if s, ok := (<-logs).(*StreamResult); !ok || s.Items() != 3 {
+		t.Errorf("logged result = %v; want 3 items", s)
+	}
+
+	// ndjson until the client disconnected
+	resp, err = http.Get(svr.URL + "/ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type = %v", ct)
+	}
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 100; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err = json.Unmarshal([]byte(line), &n); err != nil || n != i {
+			t.Fatalf("line %v = %q", i, line)
+		}
+	}
+	resp.Body.Close()
+
+	select {
+	case result := <-logs:
+		if _, ok := result.(*StreamResult); !ok {
+			t.Errorf("logged result = %v; want the stream, not an error", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream not stopped after the client disconnected")
+	}
+}
+
+func TestStreamFlushEachItem(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Handle("GET", "/slow", func(c *Context) interface{} {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			ch <- 1
+			<-c.Request.Context().Done() // a producer with nothing more for now
+		}()
+		s := StreamChan(ch)
+		s.NDJSON = true
+		return s
+	})
+
+	svr := httptest.NewServer(w)
+	defer svr.Close()
+
+	resp, err := http.Get(svr.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "1\n" {
+			t.Errorf("line = %q; want 1", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the first item is not flushed while waiting for the next")
+	}
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// TimeoutMiddleware sets a deadline to the Context of each request. If the handler overruns,
+// the context is canceled, and Error is responsed through the Responser without waiting for
+// the handler. Append it to a route or a router:
+//
+//	w.Handle("GET", "/report", Report).Append(web.NewTimeoutMiddleware(5 * time.Second))
+//
+// The handler should stop by c.Done() or by passing c to calls. Its result is dropped once
+// timed out, and it must not touch the response after that, such as ResponseHeader. The
+// Context is still safe to use, but functions registered by Defer after that never run.
+type TimeoutMiddleware struct {
+	Timeout time.Duration
+	Error   *Error // 503 Service Unavailable by default, set a 504 one for gateways
+}
+
+func NewTimeoutMiddleware(timeout time.Duration) *TimeoutMiddleware {
+	m := new(TimeoutMiddleware)
+	m.Timeout = timeout
+	m.Error = NewError("timeout", StatusServiceUnavailable).WithReason(ReasonTimeout)
+	return m
+}
+
+func (m *TimeoutMiddleware) Name() string {
+	return "timeout"
+}
+
+func (m *TimeoutMiddleware) ServeMiddleware(c *Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), m.Timeout)
+	c.Request = c.Request.WithContext(ctx)
+	c.timeout = m.Error
+	c.Defer(cancel)
+	return nil
+}
+
+var _ Middleware = (*TimeoutMiddleware)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+type callResult struct {
+	result interface{}
+	panic  interface{}
+	stack  []byte
+}
+
+// call the handler in another goroutine, and response c.timeout if it overruns
+func (h *handler) callTimeout(c *Context) interface{} {
+	done := make(chan callResult, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				done <- callResult{panic: e, stack: debug.Stack()}
+			}
+		}()
+		done <- callResult{result: h.call(c)}
+	}()
+
+	select {
+	case cr := <-done:
+		if cr.panic != nil {
+			return recoveredStack(c, cr.panic, cr.stack)
+		}
+		if _, ok := cr.result.(error); ok && c.Err() == context.DeadlineExceeded {
+			return c.timeout // such as the error of a query canceled
+		}
+		return cr.result
+
+	case <-c.Done():
+		if c.Err() != context.DeadlineExceeded {
+			// the client disconnected, nothing to response in time
+			cr := <-done
+			if cr.panic != nil {
+				return recoveredStack(c, cr.panic, cr.stack)
+			}
+			return cr.result
+		}
+
+		// report a later panic, which can't be responsed
+		go func() {
+			if cr := <-done; cr.panic != nil && c.onPanic != nil {
+				defer func() { recover() }()
+				c.onPanic(c, cr.panic, cr.stack)
+			}
+		}()
+		return c.timeout
+	}
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCtxKey struct{}
+
+func TestContextContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), testCtxKey{}, "parent"))
+	c, err := newContext(nil, r.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("user", "gopher")
+	c.Values["tenant"] = "acme" // params are not values of the context
+	if v, ok := c.Get("user"); !ok || v != "gopher" {
+		t.Errorf("Get = %v %v", v, ok)
+	}
+	if c.Value("user") != "gopher" || c.Value(testCtxKey{}) != "parent" || c.Value("tenant") != nil {
+		t.Errorf("Value = %v %v %v", c.Value("user"), c.Value(testCtxKey{}), c.Value("tenant"))
+	}
+	if RequestIdFromContext(c) != c.RequestId {
+		t.Errorf("RequestIdFromContext = %q", RequestIdFromContext(c))
+	}
+
+	if _, ok := c.Deadline(); ok || c.Canceled() {
+		t.Errorf("canceled too early")
+	}
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed")
+	}
+	if c.Err() != context.Canceled || !c.Canceled() {
+		t.Errorf("Err = %v", c.Err())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var panics []interface{}
+	var lock sync.Mutex // the hook is called by another goroutine for a late panic
+	late := make(chan struct{})
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.OnPanic(func(c *Context, v interface{}, stack []byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		panics = append(panics, v)
+		if v == "late boom" {
+			close(late)
+		}
+	})
+
+	w.Handle("GET", "/fast", func(c *Context) interface{} {
+		if _, ok := c.Deadline(); !ok {
+			t.Errorf("no deadline")
+		}
+		return "ok"
+	}).Append(NewTimeoutMiddleware(time.Second))
+
+	w.Handle("GET", "/cooperative", func(c *Context) interface{} {
+		<-c.Done()
+		return c.Err()
+	}).Append(NewTimeoutMiddleware(10 * time.Millisecond))
+
+	gateway := NewTimeoutMiddleware(10 * time.Millisecond)
+	gateway.Error = NewError("gateway timeout", StatusGatewayTimeout)
+	w.Handle("GET", "/overrun", func(c *Context) interface{} {
+		time.Sleep(50 * time.Millisecond)
+		panic("late boom")
+	}).Append(gateway)
+
+	w.Handle("GET", "/panic", func(c *Context) interface{} {
+		panic("boom")
+	}).Append(NewTimeoutMiddleware(time.Second))
+
+	for _, tt := range []struct {
+		Path string
+		Code int
+		Body string
+	}{
+		{"/fast", StatusOK, "ok"},
+		{"/cooperative", StatusServiceUnavailable, `{"error":"timeout","reason":"timeout","request_id":"req-1"}`},
+		{"/overrun", StatusGatewayTimeout, `{"error":"gateway timeout","request_id":"req-1"}`},
+		{"/panic", StatusInternalServerError, `{"error":"server error","reason":"internal","request_id":"req-1"}`},
+	} {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.Path, nil)
+		r.Header.Set("X-Request-Id", "req-1")
+		w.ServeHTTP(rec, r)
+
+		if rec.Code != tt.Code || rec.Body.String() != tt.Body {
+			t.Errorf("%s: code = %d, body = %s; want %d %s", tt.Path, rec.Code, rec.Body, tt.Code, tt.Body)
+		}
+		if used := time.Since(start); used > 40*time.Millisecond && tt.Path != "/panic" {
+			t.Errorf("%s: waited %v", tt.Path, used)
+		}
+	}
+
+	// the panic after timed out is still reported
+	select {
+	case <-late:
+	case <-time.After(time.Second):
+		t.Fatal("late panic not reported")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if fmt.Sprint(panics) != "[boom late boom]" {
+		t.Errorf("panics = %v", panics)
+	}
+}
+
+// run with -race: the handler goes on touching the context while it's responsed and logged
+func TestTimeoutOverrunRace(t *testing.T) {
+	finished := make(chan struct{})
+
+	w := NewWeb()
+	w.SetLogger(NewStdLogger())
+	w.Handle("GET", "/overrun", func(c *Context) interface{} {
+		defer close(finished)
+		<-c.Done()
+		for end := time.Now().Add(20 * time.Millisecond); time.Now().Before(end); {
+			var args struct {
+				Password string `web:"password,secret"`
+			}
+			c.Scheme(&args)
+			c.Logger()
+			c.Defer(func() {})
+		}
+		return "late"
+	}).Append(NewTimeoutMiddleware(10 * time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/overrun?password=hunter2", nil))
+	if rec.Code != StatusServiceUnavailable {
+		t.Errorf("code = %d; want 503", rec.Code)
+	}
+	<-finished
+}
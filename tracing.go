@@ -0,0 +1,395 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of spans.
+const (
+	SpanServer = "server"
+	SpanClient = "client"
+)
+
+// Span is a unit of work in a distributed trace, such as serving a request or calling another
+// service. IDs are in lower case hex, as in W3C Trace Context. Methods are safe on a nil Span.
+type Span struct {
+	Name       string
+	Kind       string // SpanServer or SpanClient
+	TraceId    string // 32 hex digits
+	SpanId     string // 16 hex digits
+	ParentId   string // empty for a root span
+	Sampled    bool   // exported only if sampled
+	TraceState string // vendor data from tracestate, propagated as is
+
+	Start      time.Time
+	End        time.Time
+	Status     int    // HTTP status code
+	Error      string // empty if succeeded
+	Attributes map[string]interface{}
+
+	exporter SpanExporter
+	b3       bool // propagate B3 headers too
+
+	lock  sync.Mutex
+	ended bool
+}
+
+// SpanExporter receives spans once they end, such as to send them to a collector.
+type SpanExporter interface {
+	ExportSpan(s *Span)
+}
+
+// Set an attribute of the span, such as "db.statement".
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+// Mark the span failed by the error.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Error = err.Error()
+}
+
+// Start a child span, in the same trace.
+func (s *Span) StartChild(name string, kind string) *Span {
+	if s == nil {
+		return nil
+	}
+	c := newSpan(name, kind, s.exporter)
+	c.TraceId = s.TraceId
+	c.ParentId = s.SpanId
+	c.Sampled = s.Sampled
+	c.TraceState = s.TraceState
+	c.b3 = s.b3
+	return c
+}
+
+// set the status and finish, with the error if none has been recorded
+func (s *Span) finishStatus(status int, err string) {
+	s.lock.Lock()
+	s.Status = status
+	if s.Error == "" {
+		s.Error = err
+	}
+	s.lock.Unlock()
+	s.Finish()
+}
+
+// Finish the span and export it. It does nothing if it has ended.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.lock.Unlock()
+
+	if s.Sampled && s.exporter != nil {
+		s.exporter.ExportSpan(s)
+	}
+}
+
+// Set headers to propagate the span to a downstream service.
+func (s *Span) Inject(h http.Header) {
+	if s == nil {
+		return
+	}
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	h.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", s.TraceId, s.SpanId, flags))
+	if s.TraceState != "" {
+		h.Set("tracestate", s.TraceState)
+	}
+	if s.b3 {
+		sampled := "0"
+		if s.Sampled {
+			sampled = "1"
+		}
+		h.Set("b3", fmt.Sprintf("%s-%s-%s", s.TraceId, s.SpanId, sampled))
+	}
+}
+
+func (s *Span) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%s %s/%s", s.Name, s.TraceId, s.SpanId)
+}
+
+func newSpan(name string, kind string, exporter SpanExporter) *Span {
+	s := new(Span)
+	s.Name = name
+	s.Kind = kind
+	s.SpanId = randomHex(8)
+	s.Start = time.Now()
+	s.exporter = exporter
+	return s
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// TracingMiddleware creates a server span for each request, named by the method and the
+// route template, such as "GET /users/{id}". The parent is extracted from W3C traceparent
+// and tracestate headers, or B3 headers if B3 is true. A new trace is started otherwise.
+//
+// The span records the status code sent, the error responsed, even one returned by another
+// middleware, and panics. Handlers get it by Context.Span, and call other services by
+// Context.HTTPClient to propagate the trace:
+//
+//	exporter := web.NewMemoryExporter()
+//	w.Append(web.NewTracingMiddleware(exporter))
+type TracingMiddleware struct {
+	B3 bool // accept and propagate B3 headers too
+
+	exporter SpanExporter
+}
+
+func NewTracingMiddleware(exporter SpanExporter) *TracingMiddleware {
+	m := new(TracingMiddleware)
+	m.exporter = exporter
+	return m
+}
+
+func (m *TracingMiddleware) Name() string {
+	return "tracing"
+}
+
+func (m *TracingMiddleware) ServeMiddleware(c *Context) error {
+	r := c.Request
+
+	route := c.Route
+	if route == "" {
+		route = r.URL.Path
+	}
+	span := newSpan(r.Method+" "+route, SpanServer, m.exporter)
+	span.b3 = m.B3
+
+	if !m.extract(span, r.Header) {
+		span.TraceId = randomHex(16)
+		span.Sampled = true
+	}
+
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.route", c.Route)
+	span.SetAttribute("http.target", r.URL.RequestURI())
+	c.span = span
+
+	c.Defer(func() {
+		st := c.ResponseState()
+		status := st.Status
+		if !st.HeaderSent {
+			status = StatusOK
+		}
+		span.SetAttribute("http.status_code", status)
+
+		// the error responsed, also one returned by a middleware before this one's response
+		var err string
+		switch {
+		case c.panics > 0:
+			span.SetAttribute("panic", true)
+			err = "panic"
+		case c.responsedErr != nil:
+			err = c.responsedErr.Error()
+		case status >= 500:
+			err = http.StatusText(status)
+		}
+		span.finishStatus(status, err)
+	})
+	return nil
+}
+
+func (m *TracingMiddleware) ServeResponse(c *Context, result interface{}) (interface{}, error) {
+	if err, ok := result.(error); ok {
+		c.span.RecordError(err)
+	}
+	return result, nil
+}
+
+// Trace a request rejected before middlewares, such as for invalid params.
+func (m *TracingMiddleware) ServeReject(c *Context, err error) {
+	m.ServeMiddleware(c)
+	c.span.RecordError(err)
+}
+
+// extract the parent span from headers, false if there is none or it's invalid
+func (m *TracingMiddleware) extract(span *Span, h http.Header) bool {
+	if tp := h.Get("traceparent"); tp != "" {
+		parts := strings.Split(strings.TrimSpace(tp), "-")
+		if len(parts) >= 4 && isHex(parts[0], 2) && parts[0] != "ff" &&
+			isHex(parts[1], 32) && !isZero(parts[1]) && isHex(parts[2], 16) && !isZero(parts[2]) && isHex(parts[3], 2) {
+			span.TraceId = parts[1]
+			span.ParentId = parts[2]
+			flags, _ := strconv.ParseUint(parts[3], 16, 8)
+			span.Sampled = flags&1 == 1
+			span.TraceState = h.Get("tracestate")
+			return true
+		}
+	}
+
+	if !m.B3 {
+		return false
+	}
+
+	var traceId, spanId, sampled string
+	if b3 := h.Get("b3"); b3 != "" {
+		parts := strings.Split(b3, "-")
+		if len(parts) < 2 {
+			return false
+		}
+		traceId, spanId = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	} else {
+		traceId, spanId, sampled = h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId"), h.Get("X-B3-Sampled")
+	}
+
+	traceId = strings.ToLower(traceId)
+	if isHex(traceId, 16) {
+		traceId = strings.Repeat("0", 16) + traceId // 64-bit trace id
+	}
+	spanId = strings.ToLower(spanId)
+	if !isHex(traceId, 32) || isZero(traceId) || !isHex(spanId, 16) || isZero(spanId) {
+		return false
+	}
+	span.TraceId = traceId
+	span.ParentId = spanId
+	span.Sampled = sampled != "0"
+	return true
+}
+
+var _ Middleware = (*TracingMiddleware)(nil)
+var _ ResponseMiddleware = (*TracingMiddleware)(nil)
+var _ RejectMiddleware = (*TracingMiddleware)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// The server span of the request, nil if TracingMiddleware is not used.
+func (c *Context) Span() *Span {
+	return c.span
+}
+
+// An HTTP client to call other services. Each request creates a client span as a child of
+// the server span, and propagates the trace by headers. It's canceled with the request.
+func (c *Context) HTTPClient() *http.Client {
+	return &http.Client{Transport: &tracingTransport{base: http.DefaultTransport, c: c}}
+}
+
+type tracingTransport struct {
+	base http.RoundTripper
+	c    *Context
+}
+
+func (t *tracingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Context().Done() == nil { // not cancelable, such as by http.NewRequest
+		r = r.WithContext(t.c.Request.Context())
+	}
+
+	span := t.c.span.StartChild(r.Method+" "+r.URL.Host, SpanClient)
+	if span == nil {
+		return t.base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context()) // a RoundTripper must not modify the request
+	span.Inject(r.Header)
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.url", r.URL.String())
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		span.Finish()
+		return resp, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	var failed string
+	if resp.StatusCode >= 500 {
+		failed = http.StatusText(resp.StatusCode)
+	}
+	span.finishStatus(resp.StatusCode, failed)
+	return resp, err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// MemoryExporter keeps spans in memory, for tests.
+type MemoryExporter struct {
+	spans []*Span
+	lock  sync.Mutex
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return new(MemoryExporter)
+}
+
+func (e *MemoryExporter) ExportSpan(s *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Get spans exported, in the order they ended.
+func (e *MemoryExporter) Spans() []*Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *MemoryExporter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = nil
+}
+
+var _ SpanExporter = (*MemoryExporter)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, ch := range s {
+		if !('0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
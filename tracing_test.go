@@ -0,0 +1,125 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	var downstream http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	exporter := NewMemoryExporter()
+	tracing := NewTracingMiddleware(exporter)
+	tracing.B3 = true
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(tracing)
+	w.Handle("GET", "/users/{id}", func(c *Context) interface{} {
+		c.Span().SetAttribute("user.id", c.Values["id"])
+		resp, err := c.HTTPClient().Get(backend.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return "ok"
+	})
+	w.Handle("GET", "/fail", func(c *Context) interface{} {
+		return errors.New("db down")
+	})
+	w.Handle("GET", "/panic", func(c *Context) interface{} {
+		panic("boom")
+	})
+	w.Handle("GET", "/private", func(c *Context) interface{} {
+		return "ok"
+	}).Append(new(testTokenMiddleware))
+	w.Handle("POST", "/users", func(c *Context) interface{} {
+		return "ok"
+	})
+
+	// propagated by traceparent
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest("GET", "/users/12", nil)
+	r.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %v", spans)
+	}
+	client, server := spans[0], spans[1]
+	if server.Name != "GET /users/{id}" || server.Kind != SpanServer || server.TraceId != traceId ||
+		server.ParentId != "00f067aa0ba902b7" || server.Status != StatusOK || server.Error != "" ||
+		server.Attributes["user.id"] != "12" {
+		t.Errorf("server span = %+v", server)
+	}
+	if client.Kind != SpanClient || client.TraceId != traceId || client.ParentId != server.SpanId || client.Status != StatusOK {
+		t.Errorf("client span = %+v", client)
+	}
+	if tp := downstream.Get("traceparent"); tp != "00-"+traceId+"-"+client.SpanId+"-01" {
+		t.Errorf("downstream traceparent = %q", tp)
+	}
+	if ts := downstream.Get("tracestate"); ts != "congo=t61rcWkgMzE" {
+		t.Errorf("downstream tracestate = %q", ts)
+	}
+	if b3 := downstream.Get("b3"); !strings.HasPrefix(b3, traceId+"-"+client.SpanId) {
+		t.Errorf("downstream b3 = %q", b3)
+	}
+
+	// errors, panics, B3 and new traces
+	exporter.Reset()
+
+	r = httptest.NewRequest("GET", "/fail", nil)
+	r.Header.Set("X-B3-TraceId", "a3ce929d0e0e4736")
+	r.Header.Set("X-B3-SpanId", "00f067aa0ba902b7")
+	w.ServeHTTP(httptest.NewRecorder(), r)
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+
+	r = httptest.NewRequest("GET", "/fail", nil)
+	r.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-00") // not sampled
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans = exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %v", spans)
+	}
+	if s := spans[0]; s.TraceId != "0000000000000000a3ce929d0e0e4736" || s.Status != 500 || s.Error != "db down" {
+		t.Errorf("fail span = %+v", s)
+	}
+	if s := spans[1]; s.ParentId != "" || len(s.TraceId) != 32 || s.Status != 500 || s.Attributes["panic"] != true {
+		t.Errorf("panic span = %+v", s)
+	}
+
+	// failed by a middleware after tracing
+	exporter.Reset()
+	w.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/private", nil))
+
+	spans = exporter.Spans()
+	if len(spans) != 1 || spans[0].Status != StatusUnauthorized || spans[0].Error != "unauthorized" {
+		t.Errorf("unauthorized spans = %v", spans)
+	}
+
+	// rejected before middlewares
+	exporter.Reset()
+	r = httptest.NewRequest("POST", "/users", strings.NewReader("x"))
+	r.Header.Set("Content-Type", "application/unknown")
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans = exporter.Spans()
+	if len(spans) != 1 || spans[0].Name != "POST /users" || spans[0].Status != 415 || spans[0].Error == "" {
+		t.Errorf("rejected spans = %v", spans)
+	}
+
+	var nilSpan *Span
+	if nilSpan.String() != "<nil>" {
+		t.Errorf("nil span = %s", nilSpan)
+	}
+}
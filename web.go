@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -60,6 +61,14 @@ type Web struct {
 
 	responser Responser
 	logger    Logger
+	decoders  map[string]Decoder
+	onPanic   func(c *Context, v interface{}, stack []byte)
+	providers map[reflect.Type]*provider
+
+	precedence []string // ParamsPrecedence if nil
+
+	sockets     map[*WSConn]struct{}
+	socketsLock sync.Mutex
 
 	wg     sync.WaitGroup
 	closed bool
@@ -79,6 +88,15 @@ func NewWeb() *Web {
 
 	w.logger = NewStdLogger()
 
+	w.decoders = make(map[string]Decoder, len(defaultDecoders))
+	for mediaType, d := range defaultDecoders {
+		w.decoders[mediaType] = d
+	}
+
+	w.providers = make(map[reflect.Type]*provider)
+
+	w.sockets = make(map[*WSConn]struct{})
+
 	w.closed = false
 	return w
 }
@@ -156,7 +174,7 @@ func (w *Web) Serve() error {
 	return err
 }
 
-// Close all listeners and stop serve HTTP.
+// Close all listeners and stop serve HTTP. A close frame is sent to every open WebSocket.
 func (w *Web) Close() {
 	for _, l := range w.listeners {
 		l.Close()
@@ -164,6 +182,13 @@ func (w *Web) Close() {
 
 	w.closed = true
 
+	w.socketsLock.Lock()
+	for ws := range w.sockets {
+		ws.Close(WSCloseGoingAway, "server closed")
+	}
+	w.sockets = nil
+	w.socketsLock.Unlock()
+
 	w.wg.Wait()
 }
 
@@ -172,6 +197,11 @@ func (w *Web) Handle(method string, path string, fn Handler) *MiddlewaresManager
 	return w.router.Handle(method, path, fn)
 }
 
+// Register a WebSocket handler for this url. See Router.HandleWebSocket
+func (w *Web) HandleWebSocket(path string, fn WebSocketHandler) *MiddlewaresManager {
+	return w.router.HandleWebSocket(path, fn)
+}
+
 // Get a sub router with the perfix path. See Router.SubRouter
 func (w *Web) SubRouter(pathPerfix string) Router {
 	return w.router.SubRouter(pathPerfix)
@@ -196,6 +226,45 @@ func (w *Web) SetLogger(l Logger) {
 	w.logger = l
 }
 
+// Set a hook to report panics recovered from handlers and middlewares, such as to an error
+// tracker. The client gets a 500 server error without the panic value and stack, unless
+// Debug is true. Like SetResponser, it only affects handlers registered after it.
+func (w *Web) OnPanic(fn func(c *Context, v interface{}, stack []byte)) {
+	w.onPanic = fn
+}
+
+// Set the precedence of locations when merging params into Context.Values for this Web, the
+// former wins. See ParamsPrecedence for the default. Like SetResponser, it only affects
+// handlers registered after it.
+//
+//	w.SetParamsPrecedence(web.LocationPath, web.LocationQuery, web.LocationBody)
+func (w *Web) SetParamsPrecedence(locations ...string) {
+	w.precedence = append([]string{}, locations...)
+}
+
+// Register a decoder to parse request body of this media type, such as "application/xml".
+// The media type is matched exactly with the one parsed from Content-Type header, without
+// parameters. A nil decoder removes the media type. Body with a media type neither registered
+// nor form is responsed 415 Unsupported Media Type for POST, PUT, PATCH and DELETE.
+//
+// JSON, XML and MessagePack decoders are registered by default. See Decoder. Like
+// SetResponser, it only affects handlers registered after it.
+func (w *Web) RegisterDecoder(mediaType string, d Decoder) {
+	mediaType = strings.ToLower(mediaType)
+
+	// copy on write, the map of handlers registered before is left as is
+	decoders := make(map[string]Decoder, len(w.decoders)+1)
+	for k, v := range w.decoders {
+		decoders[k] = v
+	}
+	if d == nil {
+		delete(decoders, mediaType)
+	} else {
+		decoders[mediaType] = d
+	}
+	w.decoders = decoders
+}
+
 // Get all registed handlers.
 // func (w *Web) GetHandlers() map[string]*handler {
 // 	return w.handlers
@@ -204,7 +273,11 @@ func (w *Web) SetLogger(l Logger) {
 func (w *Web) handle(method, urlpath string, fn Handler, midwares *MiddlewaresManager) {
 	var h *handler
 
-	h = newHandler(fn, midwares, w.responser, w.logger)
+	h = newHandler(fn, midwares, w.responser, w.logger, w.providers)
+	h.decoders = w.decoders
+	h.precedence = w.precedence
+	h.onPanic = w.onPanic
+	h.route = urlpath
 
 	// match prefix
 	var prefix bool
@@ -232,6 +305,25 @@ func (w *Web) handle(method, urlpath string, fn Handler, midwares *MiddlewaresMa
 	return
 }
 
+// track open sockets, it returns false if web has been closed
+func (w *Web) addSocket(ws *WSConn) bool {
+	w.socketsLock.Lock()
+	defer w.socketsLock.Unlock()
+
+	if w.sockets == nil {
+		return false
+	}
+	w.sockets[ws] = struct{}{}
+	return true
+}
+
+func (w *Web) removeSocket(ws *WSConn) {
+	w.socketsLock.Lock()
+	defer w.socketsLock.Unlock()
+
+	delete(w.sockets, ws)
+}
+
 func methodUrl(method string, path string) string {
 	return method + " " + strings.ToLower(path)
 }
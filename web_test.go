@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -165,3 +167,37 @@ func checkResponse(resp *http.Response, statusCode int, expctContent string, t *
 		t.Errorf("respone body = %s; want %s; url=%s", str, expctContent, resp.Request.URL.String())
 	}
 }
+
+type testTagMiddleware string
+
+func (m testTagMiddleware) ServeMiddleware(c *Context) error {
+	c.ResponseHeader.Add("X-Midd", string(m))
+	return nil
+}
+
+// Middlewares of a router apply to its routes and sub routers registered after them.
+func TestRouterMiddlewares(t *testing.T) {
+	w := NewWeb()
+	w.SetLogger(nil)
+	ok := func(c *Context) interface{} { return "ok" }
+
+	w.Append(testTagMiddleware("root"))
+	w.Handle("GET", "/a", ok)
+	sub := w.SubRouter("/sub")
+	sub.Append(testTagMiddleware("sub"))
+	sub.Handle("GET", "/b", ok)
+	w.Append(testTagMiddleware("late")) // affects neither /a nor the sub router
+	w.Handle("GET", "/c", ok)
+
+	for path, want := range map[string]string{
+		"/a":     "root",
+		"/sub/b": "root,sub",
+		"/c":     "root,late",
+	} {
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := strings.Join(rec.Header().Values("X-Midd"), ","); got != want {
+			t.Errorf("%s: middlewares = %q; want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	WSWriteTimeout         = 10 * time.Second // deadline of each write
+	WSPongTimeout          = time.Minute      // the connection is closed if no pong or message is received in time
+	WSPingInterval         = 25 * time.Second // interval of pings, must be less than WSPongTimeout
+	WSMaxMessageSize int64 = 1 << 20          // 1M
+
+	// Check the Origin header of upgrade requests. The origin must equal to the host if nil.
+	WSCheckOrigin func(r *http.Request) bool
+)
+
+// Close codes, see RFC 6455 section 7.4.
+const (
+	WSCloseNormal        = websocket.CloseNormalClosure    // 1000
+	WSCloseGoingAway     = websocket.CloseGoingAway        // 1001
+	WSCloseProtocolError = websocket.CloseProtocolError    // 1002
+	WSCloseUnsupported   = websocket.CloseUnsupportedData  // 1003
+	WSCloseNoStatus      = websocket.CloseNoStatusReceived // 1005
+	WSCloseAbnormal      = websocket.CloseAbnormalClosure  // 1006
+	WSCloseInvalidData   = websocket.CloseInvalidFramePayloadData
+	WSClosePolicy        = websocket.ClosePolicyViolation
+	WSCloseTooBig        = websocket.CloseMessageTooBig
+	WSCloseServerError   = websocket.CloseInternalServerErr
+)
+
+// Message types.
+const (
+	WSText   = websocket.TextMessage
+	WSBinary = websocket.BinaryMessage
+)
+
+// WebSocketHandler handles a WebSocket connection. The connection is closed after it returns.
+type WebSocketHandler func(c *Context, conn *WSConn)
+
+// Get the close code from an error returned by reading. It returns 0 if the error
+// is not caused by closing.
+func WSCloseCode(err error) int {
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return 0
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// WSConn is a WebSocket connection. Ping and pong are handled automatically to keep it alive.
+// Messages can be written from multiple goroutines, but should be read from one goroutine.
+type WSConn struct {
+	conn *websocket.Conn
+
+	writeLock sync.Mutex
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newWSConn(conn *websocket.Conn) *WSConn {
+	c := new(WSConn)
+	c.conn = conn
+	c.closed = make(chan struct{})
+
+	conn.SetReadLimit(WSMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	})
+
+	go c.keepalive()
+	return c
+}
+
+// Read a message. The type is WSText or WSBinary. Use WSCloseCode to get the close code
+// if the peer closed the connection.
+func (c *WSConn) ReadMessage() (messageType int, data []byte, err error) {
+	messageType, data, err = c.conn.ReadMessage()
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	}
+	return
+}
+
+// Read a message in JSON format into v.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	err := c.conn.ReadJSON(v)
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	}
+	return err
+}
+
+// Write a message with type WSText or WSBinary.
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(WSWriteTimeout))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// Write v as a text message in JSON format.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(WSWriteTimeout))
+	return c.conn.WriteJSON(v)
+}
+
+// Send a close frame with the code and reason. The peer should reply a close frame, then
+// the reading returns an error. The connection is closed by force if the peer doesn't reply
+// within WSWriteTimeout.
+func (c *WSConn) Close(code int, reason string) error {
+	msg := websocket.FormatCloseMessage(code, reason)
+	err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WSWriteTimeout))
+	c.conn.SetReadDeadline(time.Now().Add(WSWriteTimeout))
+	return err
+}
+
+// Closed after the connection is closed.
+func (c *WSConn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// The underlying connection of gorilla/websocket.
+func (c *WSConn) Conn() *websocket.Conn {
+	return c.conn
+}
+
+func (c *WSConn) keepalive() {
+	ticker := time.NewTicker(WSPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WSWriteTimeout))
+			if err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// close the underlying connection after the handler returned
+func (c *WSConn) release() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.Close(WSCloseNormal, "")
+		c.conn.Close()
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// upgrade to WebSocket after middlewares, as the result of a handler
+type wsUpgrade struct {
+	web *Web
+	fn  WebSocketHandler
+}
+
+func (u *wsUpgrade) StatusCode() int {
+	return http.StatusSwitchingProtocols
+}
+
+func (u *wsUpgrade) OnWrite(w http.ResponseWriter) error {
+	return errors.New("websocket: request is required to upgrade")
+}
+
+func (u *wsUpgrade) OnWriteContext(c *Context) error {
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: WSWriteTimeout,
+		CheckOrigin:      WSCheckOrigin,
+	}
+
+	conn, err := upgrader.Upgrade(c.ResponseWriter, c.Request, nil)
+	if err != nil {
+		return err // response has been written by upgrader
+	}
+
+	ws := newWSConn(conn)
+	if !u.web.addSocket(ws) { // the web is closing, don't serve a new one
+		ws.Close(WSCloseGoingAway, "server closed")
+		ws.release()
+		return nil
+	}
+	defer func() {
+		u.web.removeSocket(ws)
+		ws.release()
+	}()
+
+	u.fn(c, ws)
+	return nil
+}
+
+func (u *wsUpgrade) String() string {
+	return "websocket"
+}
+
+var _ ContextWriteable = (*wsUpgrade)(nil)
+var _ StatusCode = (*wsUpgrade)(nil)
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type testTokenMiddleware struct{}
+
+func (m *testTokenMiddleware) ServeMiddleware(c *Context) error {
+	if c.Request.URL.Query().Get("token") != "secret" {
+		return NewError("unauthorized", StatusUnauthorized)
+	}
+	return nil
+}
+
+func TestWebSocket(t *testing.T) {
+	closeCode := make(chan int, 1)
+
+	w := NewWeb()
+	w.SetLogger(nil)
+	w.Append(new(testTokenMiddleware))
+	w.HandleWebSocket("/ws", func(c *Context, conn *WSConn) {
+		for {
+			var msg map[string]interface{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				closeCode <- WSCloseCode(err)
+				return
+			}
+			msg["echo"] = true
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	})
+
+	svr := httptest.NewServer(w)
+	defer svr.Close()
+	url := "ws" + strings.TrimPrefix(svr.URL, "http") + "/ws"
+
+	// rejected by middleware
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without token: err = %v, resp = %v; want 401", err, resp)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.WriteJSON(map[string]interface{}{"msg": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]interface{}
+	if err = conn.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply["msg"] != "hi" || reply["echo"] != true {
+		t.Errorf("reply = %v", reply)
+	}
+
+	// close web, the client receives a close frame
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+
+	_, _, err = conn.ReadMessage()
+	if code := WSCloseCode(err); code != WSCloseGoingAway {
+		t.Errorf("close code = %v, err = %v; want %v", code, err, WSCloseGoingAway)
+	}
+
+	select {
+	case code := <-closeCode:
+		if code != WSCloseGoingAway {
+			t.Errorf("server side close code = %v; want %v", code, WSCloseGoingAway)
+		}
+	case <-time.After(time.Second):
+		t.Error("handler not returned after close")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("web not closed")
+	}
+
+	// accepted before closed but upgraded after, closed without calling the handler
+	w.closed = false
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _, err = conn.ReadMessage()
+	if code := WSCloseCode(err); code != WSCloseGoingAway {
+		t.Errorf("close code after closed = %v, err = %v; want %v", code, err, WSCloseGoingAway)
+	}
+	select {
+	case code := <-closeCode:
+		t.Errorf("handler called after closed, close code = %v", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+}